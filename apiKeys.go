@@ -1,17 +1,56 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"strings"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
 )
 
+const apiKeyValidationTimeout = 15 * time.Second
+
+const maxAPIKeyAttempts = 3
+
+// validateAPIKey checks the API key with the provider, keys of engines without validation are accepted as is.
+func validateAPIKey(aiProvider string, apiKey string) (bool, error) {
+	engine, exists := engineMap[aiProvider]
+	if !exists {
+		return false, fmt.Errorf("no engine found for %s", aiProvider)
+	}
+
+	validator, ok := engine.(askai.APIKeyValidator)
+	if !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyValidationTimeout)
+	defer cancel()
+
+	if err := validator.ValidateAPIKey(ctx, apiKey); err != nil {
+		return true, fmt.Errorf("API key for %s is rejected: %w", aiProvider, err)
+	}
+
+	return true, nil
+}
+
 func processMissedAPIKeys(apiKeys map[string]string, engines []string) (map[string]string, error) {
 	missedKeys := make([]string, 0, len(engines))
-	for _, key := range engines {
-		if _, exists := apiKeys[key]; !exists {
-			missedKeys = append(missedKeys, key)
+	missedProviders := make(map[string]bool)
+	for _, engine := range engines {
+		aiProvider, _, err := askai.SplitEngineName(engine)
+		if err != nil {
+			return nil, err
+		}
+
+		if askai.IsTestEngine(aiProvider) || missedProviders[aiProvider] {
+			continue
+		}
+
+		if _, exists := apiKeys[aiProvider]; !exists {
+			missedKeys = append(missedKeys, engine)
+			missedProviders[aiProvider] = true
 		}
 	}
 
@@ -31,27 +70,26 @@ func processMissedAPIKeys(apiKeys map[string]string, engines []string) (map[stri
 	return newAPIKeys, nil
 }
 
+// askAPIKeys asks user for API keys on the terminal, so stdin can carry the prompt.
 func askAPIKeys(engines []string) (map[string]string, error) {
-	reader := bufio.NewReader(os.Stdin)
-	if reader == nil {
-		return nil, fmt.Errorf("bufio.NewReader failed")
-	}
-
 	apiKeys := make(map[string]string)
 
 	for _, engine := range engines {
-		aiProvider, _, err := splitEngineName(engine)
+		aiProvider, _, err := askai.SplitEngineName(engine)
 		if err != nil {
 			return nil, err
 		}
 
-		fmt.Printf("Enter API key for %s:\n", aiProvider)
-		apiKey, err := reader.ReadString('\n')
+		if !hasTerminal() {
+			return nil, fmt.Errorf("API key for %s is not set, set it with '%s %s set %s'",
+				aiProvider, programName, keysCommandName, aiProvider)
+		}
+
+		apiKey, err := askAPIKey(aiProvider)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read API key from stdin: %w", err)
+			return nil, err
 		}
 
-		apiKey = strings.TrimSpace(apiKey)
 		if apiKey == "" {
 			continue
 		}
@@ -65,3 +103,25 @@ func askAPIKeys(engines []string) (map[string]string, error) {
 
 	return apiKeys, nil
 }
+
+// askAPIKey reads API key without echo and checks it with the provider, a rejected key is asked again.
+// An empty input skips the provider.
+func askAPIKey(aiProvider string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		apiKey, err := readHiddenInput(fmt.Sprintf("Enter API key for %s: ", aiProvider))
+		if err != nil || apiKey == "" {
+			return "", err
+		}
+
+		_, err = validateAPIKey(aiProvider, apiKey)
+		if err == nil {
+			return apiKey, nil
+		}
+
+		if attempt == maxAPIKeyAttempts {
+			return "", err
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -1,22 +1,84 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/ilia-funtov/askai/pkg/askai"
 	log "github.com/sirupsen/logrus"
 )
 
 func run() error {
+	profile, args, err := extractProfileOption(os.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	configProfile = profile
+
+	command, args := splitCommand(args)
+
+	// ask command is run by the daemon if it's running, before the configuration is loaded
+	if command.name == askCommandName {
+		if handled, err := askViaDaemon(profile, args); handled {
+			return err
+		}
+	}
+
 	programConfig, err := initProgramConfig()
 	if err != nil {
-		return fmt.Errorf("failed to init program configuration: %w", err)
+		// config command doesn't need valid configuration, it's used to fix it
+		if command.name != configCommandName {
+			return fmt.Errorf("failed to init program configuration: %w", err)
+		}
+
+		return command.run(args, nil)
+	}
+
+	initEngines(*programConfig)
+	askai.InitTokenizers(programConfig.Tokenizer.encodingCache(), log.StandardLogger())
+	initAuditLog(programConfig.Audit)
+
+	shutdownTelemetry, err := initTelemetry(programConfig.Telemetry)
+	if err != nil {
+		return fmt.Errorf("failed to init telemetry: %w", err)
+	}
+	defer shutdownTelemetry()
+
+	return command.run(args, programConfig)
+}
+
+func runAskCommand(args []string, programConfig *ProgramConfig) error {
+	flagSet := newCommandFlagSet(askCommandName)
+	flagSet.Usage = func() {
+		printCommandsUsage(flagSet.Output())
+		fmt.Fprintln(flagSet.Output())
+		printCommandUsage(flagSet.Output(), askCommandName)
+		flagSet.PrintDefaults()
 	}
 
 	var progOptions ProgramOptions
-	progOptions.add(programConfig.Engine)
-	progOptions.parse()
+	progOptions.add(flagSet, programConfig.Engine)
+
+	parsed, err := progOptions.parse(flagSet, args)
+	if !parsed {
+		return err
+	}
+
+	if err = progOptions.validate(); err != nil {
+		return err
+	}
+
+	if progOptions.contentType != "" {
+		programConfig.Tokenizer.ContentType = progOptions.contentType
+	}
+
+	if progOptions.debug {
+		enableDebugLogging()
+	}
 
 	log.Debugf("Program options: %v", progOptions)
 
@@ -33,40 +95,119 @@ func run() error {
 		}
 	}
 
-	message := UserMessage{Prompt: progOptions.cmdPrompt, Context: stdinPrompt}
+	return askWithOptions(context.Background(), progOptions, stdinPrompt, programConfig, os.Stdout, os.Stderr)
+}
+
+// askWithOptions asks AI engines the prompt of the options and the one read from stdin, answers are written to stdout,
+// notices to stderr. The options are already validated and API keys of the engines are resolved.
+func askWithOptions(ctx context.Context, progOptions ProgramOptions, stdinPrompt string, programConfig *ProgramConfig,
+	stdout io.Writer, stderr io.Writer) error {
+	var err error
+
+	// all requests of the command, including summarization and the judge, are in one audit session
+	programConfig.auditSession = newAuditSession()
+
+	message := askai.UserMessage{Prompt: progOptions.cmdPrompt, Context: stdinPrompt}
+
+	var redactor *Redactor
+	if !progOptions.noRedact {
+		redactor, err = newRedactor(programConfig.Redaction, progOptions.restore)
+		if err != nil {
+			return err
+		}
+
+		message = redactor.redactMessage(message)
+		if summary := redactor.summary(); summary != "" {
+			fmt.Fprintf(stderr, "Redacted from the prompt: %s. Use -noredact to send it as is.\n", summary)
+		}
+	}
+
 	prompt := message.GetFullPrompt()
 
-	log.Infof("Prompt: %s", prompt)
+	log.Infof("Prompt: %s", askai.LogText(logPromptMode, prompt))
 
 	if prompt == "" {
 		return fmt.Errorf("prompt to AI is empty")
 	}
 
 	if progOptions.printPrompt {
-		fmt.Printf("Prompt: %s", prompt)
+		fmt.Fprintf(stdout, "Prompt: %s", prompt)
+	}
+
+	if progOptions.compare != "" {
+		allStats := compareEngines(ctx, progOptions.engines, message, *programConfig)
+		for i := range allStats {
+			allStats[i].responses = redactor.restoreResponses(allStats[i].responses)
+		}
+		return printComparison(stdout, allStats, progOptions.compare, progOptions.diffEngines)
+	}
+
+	var responseMap map[string][]string
+	if progOptions.firstAnswer {
+		var check askai.ResponseCheck
+		check, err = askai.NewResponseCheck(progOptions.firstMatch)
+		if err != nil {
+			return err
+		}
+
+		responseMap, err = newAIClient(*programConfig).AskFirst(ctx, progOptions.engines, message, check)
+	} else {
+		responseMap, err = newAIClient(*programConfig).Ask(ctx, progOptions.engines, message)
 	}
 
-	responseMap, err := askAI(progOptions.engines, message, *programConfig)
 	if err != nil {
 		return fmt.Errorf("failed to ask AI: %w", err)
 	}
 
-	printResponses(responseMap, progOptions, *programConfig)
+	switch {
+	case progOptions.judge != "":
+		callResult := judgeResponses(ctx, progOptions.judge, message, responseMap, *programConfig)
+		if callResult.Err != nil {
+			return callResult.Err
+		}
+
+		// answers are restored only for output, the judge gets them redacted
+		responses := redactor.restoreResponses(callResult.Responses)
+		printFinalResponses(stdout, redactor.restoreResponseMap(responseMap), callResult.EngineKey, responses, progOptions, *programConfig)
+	case progOptions.vote:
+		answer, votes, err := voteResponses(responseMap)
+		if err != nil {
+			return err
+		}
+
+		engineKey := fmt.Sprintf("%s %d/%d", voteEngineKey, votes, len(responseMap))
+		answers := redactor.restoreResponses([]string{answer})
+		printFinalResponses(stdout, redactor.restoreResponseMap(responseMap), engineKey, answers, progOptions, *programConfig)
+	default:
+		printResponses(stdout, redactor.restoreResponseMap(responseMap), progOptions, *programConfig)
+	}
 
 	return nil
 }
 
-func printResponses(responseMap map[string][]string, progOptions ProgramOptions, progConfig ProgramConfig) {
+// printFinalResponses prints responses made of answers of several engines,
+// optionally preceded by the individual answers.
+func printFinalResponses(w io.Writer, responseMap map[string][]string, engineKey string, responses []string,
+	progOptions ProgramOptions, progConfig ProgramConfig) {
+	if progOptions.printAll {
+		progOptions.printAIEngine = true
+		printResponses(w, responseMap, progOptions, progConfig)
+	}
+
+	printResponses(w, map[string][]string{engineKey: responses}, progOptions, progConfig)
+}
+
+func printResponses(w io.Writer, responseMap map[string][]string, progOptions ProgramOptions, progConfig ProgramConfig) {
 	for engineKey, responses := range responseMap {
 		log.Infof("Engine: %s", engineKey)
 		log.Infof("Number of responses: %d", len(responses))
-		log.Tracef("Responses: %v", responses)
+		log.Tracef("Responses: %v", askai.LogTexts(logPromptMode, responses))
 
 		if progOptions.printAIEngine {
-			fmt.Println(fmt.Sprintf(progConfig.PrintAIEngineTemplate, engineKey))
+			fmt.Fprintln(w, fmt.Sprintf(progConfig.PrintAIEngineTemplate, engineKey))
 		}
 		for _, response := range responses {
-			fmt.Println(strings.TrimSpace(response))
+			fmt.Fprintln(w, strings.TrimSpace(response))
 		}
 	}
 }
@@ -1,243 +1,88 @@
 package main
 
 import (
-	"fmt"
-	"math"
-	"reflect"
-	"strings"
+	"context"
 
+	"github.com/ilia-funtov/askai/pkg/askai"
 	log "github.com/sirupsen/logrus"
 )
 
-type UserMessage struct {
-	Prompt  string
-	Context string
-}
-
-type AIEngine interface {
-	AskAI(message UserMessage, model string, apiKey string) ([]string, error)
-	GetMaxTokenLimit(model string) int
-	GetTokenizationEncoding(model string) (string, error)
-	CalcTokenNum(model string, text string) (int, error)
-	SplitText(model string, text string, maxTokenLen int) ([]string, error)
-}
-
-const (
-	errorMessageCalcTokenNum = "AIEngine.CalcTokenNum failed: %w"
-)
+const errorMessageCalcTokenNum = "AIEngine.CalcTokenNum failed: %w"
 
-type EngineCallResult struct {
-	engineKey string
-	responses []string
-	err       error
-}
+// engineMap holds engines of all providers, they are replaced with the configured ones on start, see initEngines.
+var engineMap = askai.DefaultEngines()
 
-var engineMap = map[string]AIEngine{
-	"openai": &OpenAIEngine{},
-	"cohere": &CohereEngine{},
-}
+// engineTokenizer is the tokenizer config engines of engineMap are created with.
+var engineTokenizer askai.TokenizerConfig
 
-func (message UserMessage) GetFullPrompt() string {
-	return makeFullPrompt(message.Prompt, message.Context)
+// initEngines replaces engines of engineMap with ones using tokenizer and mock settings of the config.
+func initEngines(config ProgramConfig) {
+	engineMap = newEngines(config)
+	engineTokenizer = config.Tokenizer.tokenizer()
 }
 
-func askAI(engines []string, message UserMessage, config ProgramConfig) (map[string][]string, error) {
-	if len(engines) == 0 {
-		return nil, fmt.Errorf("no AI engine found")
-	}
+func newEngines(config ProgramConfig) map[string]askai.AIEngine {
+	engines := askai.NewEngines(config.Tokenizer.tokenizer(), log.StandardLogger())
 
-	result := make(map[string][]string)
-
-	processEngine := func(engine string, message UserMessage, apiKeys map[string]string) EngineCallResult {
-		aiProvider, aiModel, err := splitEngineName(engine)
-		if err != nil {
-			return EngineCallResult{"", nil, err}
-		}
+	mock := askai.NewMockEngine(config.Mock)
+	mock.Tokenizer = config.Tokenizer.tokenizer()
+	mock.Logger = log.StandardLogger()
+	engines["mock"] = mock
 
-		return callAIEngine(aiProvider, aiModel, message, config)
-	}
-
-	if len(engines) == 1 {
-		callResult := processEngine(engines[0], message, config.APIKeys)
-		if callResult.err != nil {
-			return nil, callResult.err
-		}
-
-		result[callResult.engineKey] = callResult.responses
-		return result, nil
-	}
-
-	resultChannel := make(chan EngineCallResult)
-	processEngineAsync := func(engine string, message UserMessage, apiKeys map[string]string) {
-		callResult := processEngine(engine, message, apiKeys)
-		resultChannel <- callResult
-	}
-
-	for _, engine := range engines {
-		go processEngineAsync(engine, message, config.APIKeys)
-	}
-
-	for i := 0; i != len(engines); i++ {
-		callResult, ok := <-resultChannel
-		if ok {
-			result[callResult.engineKey] = callResult.responses
-		}
-	}
-
-	return result, nil
+	return engines
 }
 
-func callAIEngine(aiProvider string, aiModel string, message UserMessage, config ProgramConfig) EngineCallResult {
-	if aiModel == "" {
-		var exists bool
-		aiModel, exists = config.ProviderModel[aiProvider]
-		if !exists {
-			return EngineCallResult{"", nil, fmt.Errorf("no provider model found for %s", aiProvider)}
-		}
-	}
-
-	engineKey := fmt.Sprintf("%s:%s", aiProvider, aiModel)
-
-	engine, exists := engineMap[aiProvider]
-	if !exists {
-		return EngineCallResult{engineKey, nil, fmt.Errorf("no engine found for %s", aiProvider)}
-	}
-
-	apiKey, exists := config.APIKeys[aiProvider]
-	if !exists {
-		return EngineCallResult{"", nil, fmt.Errorf("no API key found for %s", aiProvider)}
-	}
-
-	prompt := message.GetFullPrompt()
-	log.Infof("Asking %s: %s", engineKey, prompt)
-
-	tokensInFullPrompt, err := engine.CalcTokenNum(aiModel, prompt)
-	if err != nil {
-		return EngineCallResult{engineKey, nil, err}
-	}
-
-	tokenLimit := engine.GetMaxTokenLimit(aiModel)
-
-	if tokensInFullPrompt > tokenLimit {
-		log.Infof("Full prompt is too long, shortening it to %d tokens at max", tokenLimit)
-
-		pMessage, err := shortenMessage(message, tokenLimit, engine, aiModel, apiKey, config.SummarizePrompt)
-		if err != nil {
-			return EngineCallResult{engineKey, nil, err}
-		}
-
-		message = *pMessage
-	}
-
-	responses, err := engine.AskAI(message, aiModel, apiKey)
-	if err == nil {
-		log.Tracef("Engine %s returned response: %v", engineKey, responses)
-	} else {
-		log.Errorf("Engine %s returned error: %v", engineKey, err)
+// commandEngines returns engines a command is run with. They are engines of engineMap, unless the command
+// changes tokenizer settings of the configuration, e.g. content type by a flag, then new engines are created,
+// so commands run by the daemon at the same time don't affect each other.
+func commandEngines(config ProgramConfig) map[string]askai.AIEngine {
+	if config.Tokenizer.tokenizer() == engineTokenizer {
+		return engineMap
 	}
 
-	return EngineCallResult{engineKey, responses, err}
+	return newEngines(config)
 }
 
-func shortenMessage(message UserMessage, tokenLimit int, engine AIEngine, aiModel string, apiKey string, tldrPrompt string) (*UserMessage, error) {
-	tokensInPrompt, err := engine.CalcTokenNum(aiModel, message.Prompt)
-	if err != nil {
-		return nil, fmt.Errorf(errorMessageCalcTokenNum, err)
-	}
-
-	tokensInContext, err := engine.CalcTokenNum(aiModel, message.Context)
-	if err != nil {
-		return nil, fmt.Errorf(errorMessageCalcTokenNum, err)
-	}
-
-	shortenedPrompt, err := shortenText(message.Prompt, tokenLimit-tokensInContext-1, engine, aiModel, apiKey, tldrPrompt)
-	if err != nil {
-		return nil, err
-	}
-
-	shortenedContext, err := shortenText(message.Context, tokenLimit-tokensInPrompt-1, engine, aiModel, apiKey, tldrPrompt)
-	if err != nil {
-		return nil, err
-	}
-
-	message = UserMessage{Prompt: shortenedPrompt, Context: shortenedContext}
-	return &message, nil
+// engineCallObserver records requests to engines in the audit log under the audit session and in telemetry.
+type engineCallObserver struct {
+	auditSession string
 }
 
-func shortenText(text string, maxTokens int, engine AIEngine, aiModel string, apiKey string, tldrPrompt string) (string, error) {
-	if text == "" || maxTokens <= 0 {
-		return "", nil
-	}
-
-	tokensNum, err := engine.CalcTokenNum(aiModel, text)
-	if err != nil {
-		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
-	}
-
-	if tokensNum <= maxTokens {
-		return text, nil
-	}
-
-	log.Tracef("Shortening text: %s", text)
-
-	tldrLen, err := engine.CalcTokenNum(aiModel, tldrPrompt)
-	if err != nil {
-		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
-	}
-
-	numBlocks := int(math.Ceil(float64(tokensNum) / float64(maxTokens)))
-	blockTokensNum := (tokensNum / numBlocks) - (tldrLen + 1)
-	parts, err := engine.SplitText(aiModel, text, blockTokensNum)
-	if err != nil {
-		return "", fmt.Errorf("AIEngine.SplitText failed: %w", err)
-	}
-
-	shortenedText, err := shortenTextParts(parts, engine, aiModel, apiKey, tldrPrompt)
-	if err != nil {
-		return "", err
-	}
-
-	if shortenedText == "" {
-		return "", fmt.Errorf("text content was completely lost as a result of shortening")
-	}
+// newAIClient returns the client of AI engines configured by the program config.
+func newAIClient(config ProgramConfig) *askai.Client {
+	return newAIClientWithEngines(config, commandEngines(config))
+}
 
-	shortLen, err := engine.CalcTokenNum(aiModel, shortenedText)
-	if err != nil {
-		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
-	}
+// newAIClientWithEngines creates a client with engines made beforehand, like the ones a server keeps.
+func newAIClientWithEngines(config ProgramConfig, engines map[string]askai.AIEngine) *askai.Client {
+	options := askai.Options{
+		Engines:         engines,
+		ProviderModel:   config.ProviderModel,
+		APIKeys:         config.APIKeys,
+		SummarizePrompt: config.SummarizePrompt,
+		FallbackPolicy:  config.FallbackPolicy,
+		LogPrompts:      logPromptMode,
+	}
+
+	// tokens of requests are counted only if there is anything to record them in
+	if auditLog != nil || telemetryEnabled {
+		auditSession := config.auditSession
+		if auditSession == "" {
+			auditSession = newAuditSession()
+		}
 
-	if shortLen > maxTokens {
-		return shortenText(shortenedText, maxTokens, engine, aiModel, apiKey, tldrPrompt)
+		options.Observer = engineCallObserver{auditSession: auditSession}
 	}
 
-	log.Tracef("Shortened text: %s", shortenedText)
-
-	return shortenedText, nil
+	return askai.NewClient(options)
 }
 
-func shortenTextParts(parts []string, engine AIEngine, aiModel string, apiKey string, tldrPrompt string) (string, error) {
-	shortenedText := ""
-
-	for _, part := range parts {
-		log.Tracef("Asking to shorten part: %s", part)
-
-		message := UserMessage{Prompt: tldrPrompt, Context: part}
-		responses, err := engine.AskAI(message, aiModel, apiKey)
-		if err != nil {
-			log.Errorf("Engine %s returned error: %v", reflect.TypeOf(engine), err)
-
-			return "", fmt.Errorf("could not shorten text: %w", err)
-		}
-
-		for _, response := range responses {
-			if len(response) > 0 {
-				if len(shortenedText) > 0 {
-					shortenedText += " "
-				}
-				shortenedText += response
-			}
-		}
-	}
+// BeforeCall records the request as sent, so nothing is sent if auditing is on, but the audit log can't be written.
+func (o engineCallObserver) BeforeCall(ctx context.Context, call *askai.EngineCall) error {
+	return auditLog.recordSent(o.auditSession, *call)
+}
 
-	return strings.TrimSpace(shortenedText), nil
+func (o engineCallObserver) AfterCall(ctx context.Context, call *askai.EngineCall) {
+	auditLog.recordResult(o.auditSession, *call)
+	recordEngineCallTelemetry(ctx, *call)
 }
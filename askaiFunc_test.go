@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeMockResponses(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "responses.json")
+	err := os.WriteFile(path, []byte(data), 0600)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestNewAIClient(t *testing.T) {
+	savedMock := engineMap["mock"]
+	defer func() { engineMap["mock"] = savedMock }()
+
+	path := writeMockResponses(t, `[{"match": "^Hello", "response": "Hi."}]`)
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{ResponsesFile: path})
+
+	config := ProgramConfig{ProviderModel: defaultProviderModel, FallbackPolicy: askai.FallbackPolicyNone}
+	message := askai.UserMessage{Prompt: "Hello", Context: "world"}
+
+	responseMap, err := newAIClient(config).Ask(context.Background(), []string{"echo", "mock"}, message)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"echo:echo": {"Hello\nworld"}, "mock:mock": {"Hi."}}, responseMap)
+
+	_, err = newAIClient(config).Ask(context.Background(), []string{"openai>echo"}, message)
+	assert.ErrorContains(t, err, "no API key found for openai")
+}
+
+func TestVoteResponses(t *testing.T) {
+	responseMap := map[string][]string{
+		"a": {"Yes."},
+		"b": {"no"},
+		"c": {" yes"},
+	}
+
+	answer, votes, err := voteResponses(responseMap)
+	assert.NoError(t, err)
+	assert.Equal(t, "Yes.", answer)
+	assert.Equal(t, 2, votes)
+
+	_, _, err = voteResponses(map[string][]string{"a": {""}})
+	assert.Error(t, err)
+}
+
+func TestJudgeResponses(t *testing.T) {
+	config := ProgramConfig{ProviderModel: defaultProviderModel, JudgePrompt: "Merge:"}
+	message := askai.UserMessage{Prompt: "Question?"}
+	responseMap := map[string][]string{"a": {"First."}, "b": {"Second."}}
+
+	callResult := judgeResponses(context.Background(), "echo", message, responseMap, config)
+	assert.NoError(t, callResult.Err)
+	assert.Equal(t, "echo:echo", callResult.EngineKey)
+	assert.Equal(t, []string{"Merge:\nQuestion:\nQuestion?\n\nAnswer 1:\nFirst.\n\nAnswer 2:\nSecond.\n"}, callResult.Responses)
+}
+
+func TestCommandEngines(t *testing.T) {
+	savedEngines, savedTokenizer := engineMap, engineTokenizer
+	defer func() { engineMap, engineTokenizer = savedEngines, savedTokenizer }()
+
+	config := ProgramConfig{Tokenizer: TokenizerConfig{ContentType: "auto", Overlap: 2}}
+	initEngines(config)
+	assert.Equal(t, askai.TokenizerConfig{ContentType: "auto", Overlap: 2}, engineMap["echo"].(*askai.EchoEngine).Tokenizer)
+	assert.Equal(t, askai.TokenizerConfig{ContentType: "auto", Overlap: 2}, engineMap["mock"].(*askai.MockEngine).Tokenizer)
+
+	engines := commandEngines(config)
+	assert.True(t, engines["echo"] == engineMap["echo"])
+
+	// content type set by the option doesn't change engines of other commands
+	config.Tokenizer.ContentType = "code"
+	engines = commandEngines(config)
+	assert.False(t, engines["echo"] == engineMap["echo"])
+	assert.Equal(t, "code", engines["echo"].(*askai.EchoEngine).Tokenizer.ContentType)
+	assert.Equal(t, "auto", engineMap["echo"].(*askai.EchoEngine).Tokenizer.ContentType)
+}
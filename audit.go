@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+)
+
+// Ways to record prompts in the audit log.
+const (
+	auditPromptsHash = "hash"
+	auditPromptsFull = "full"
+)
+
+// Statuses of requests in the audit log.
+const (
+	auditStatusSent     = "sent"
+	auditStatusAnswered = "answered"
+	auditStatusFailed   = "failed"
+)
+
+const auditSessionIDLen = 8
+
+// AuditConfig configures the audit log of all requests sent to AI providers.
+type AuditConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+	Prompts string `json:"prompts"`
+}
+
+// AuditRecord is a line of the audit log about one request to an AI engine. A request is recorded
+// as sent before it's sent and once again with its result, so requests which never got one are seen too.
+type AuditRecord struct {
+	Time           time.Time `json:"time"`
+	Session        string    `json:"session"`
+	Request        uint64    `json:"request"`
+	Status         string    `json:"status"`
+	Kind           string    `json:"kind"`
+	Engine         string    `json:"engine"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model"`
+	PromptHash     string    `json:"prompthash"`
+	Prompt         string    `json:"prompt,omitempty"`
+	PromptTokens   int       `json:"prompttokens"`
+	ResponseHashes []string  `json:"responsehashes,omitempty"`
+	ResponseTokens int       `json:"responsetokens"`
+	DurationMs     int64     `json:"durationms"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// AuditLog appends records to the audit file, which is opened on the first request.
+// A nil AuditLog records nothing.
+type AuditLog struct {
+	path    string
+	prompts string
+
+	openOnce sync.Once
+	openErr  error
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// auditLog is the audit log of this run, it's nil if auditing is off.
+var auditLog *AuditLog
+
+func validateAuditConfig(config AuditConfig) error {
+	if config.Prompts != "" && config.Prompts != auditPromptsHash && config.Prompts != auditPromptsFull {
+		return fmt.Errorf("invalid value of config key audit.prompts: %q, expected %s or %s",
+			config.Prompts, auditPromptsHash, auditPromptsFull)
+	}
+
+	if config.Enabled && config.File == "" {
+		return fmt.Errorf("invalid value of config key audit.file: audit is enabled, but file is not set")
+	}
+
+	return nil
+}
+
+// initAuditLog opens the audit log if auditing is enabled. The audit config comes only from
+// the system and user config files and the environment, project config files can't set it.
+func initAuditLog(config AuditConfig) {
+	if !config.Enabled {
+		auditLog = nil
+		return
+	}
+
+	auditLog = &AuditLog{
+		path:    expandHomeDir(config.File),
+		prompts: config.Prompts,
+	}
+}
+
+// newAuditSession starts a new audit session: a run of ask command, a request to the daemon or the server,
+// or a connection of MCP client. It returns an empty string if auditing is off.
+func newAuditSession() string {
+	if auditLog == nil {
+		return ""
+	}
+
+	session := newSessionID()
+	log.Infof("Audit session: %s", session)
+
+	return session
+}
+
+// newSessionID returns a random id of the session, which groups its records in the audit log.
+func newSessionID() string {
+	id := make([]byte, auditSessionIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(id)
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (a *AuditLog) open() error {
+	if a == nil {
+		return nil
+	}
+
+	a.openOnce.Do(func() {
+		const dirPermissionMask = 0700
+		if err := os.MkdirAll(filepath.Dir(a.path), dirPermissionMask); err != nil {
+			a.openErr = fmt.Errorf("failed to create audit log directory: %w", err)
+			return
+		}
+
+		const auditPermissionMask = 0600
+		a.file, a.openErr = os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, auditPermissionMask)
+		if a.openErr != nil {
+			a.openErr = fmt.Errorf("failed to open audit log: %w", a.openErr)
+		}
+	})
+
+	return a.openErr
+}
+
+func (a *AuditLog) write(record AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+
+	if err := a.open(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit record: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// a record is written with a single call, so records of concurrent requests don't interleave
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+func (a *AuditLog) newRecord(session string, call askai.EngineCall) AuditRecord {
+	prompt := call.Message.GetFullPrompt()
+
+	record := AuditRecord{
+		Session:    session,
+		Request:    call.ID,
+		Kind:       call.Kind,
+		Engine:     call.EngineKey(),
+		Provider:   call.Provider,
+		Model:      call.Model,
+		PromptHash: hashText(prompt),
+	}
+
+	if a.prompts == auditPromptsFull {
+		record.Prompt = prompt
+	}
+
+	return record
+}
+
+// recordSent writes a record about the engine call before it's sent, the call isn't sent if it fails.
+func (a *AuditLog) recordSent(session string, call askai.EngineCall) error {
+	if a == nil {
+		return nil
+	}
+
+	record := a.newRecord(session, call)
+	record.Time = time.Now().UTC()
+	record.Status = auditStatusSent
+
+	return a.write(record)
+}
+
+// recordResult writes a record about the engine call with its result.
+func (a *AuditLog) recordResult(session string, call askai.EngineCall) {
+	if a == nil {
+		return
+	}
+
+	record := a.newRecord(session, call)
+	record.Time = call.Start.UTC()
+	record.Status = auditStatusAnswered
+	record.PromptTokens = call.PromptTokens
+	record.ResponseTokens = call.ResponseTokens
+	record.DurationMs = call.Duration.Milliseconds()
+
+	for _, response := range call.Responses {
+		record.ResponseHashes = append(record.ResponseHashes, hashText(response))
+	}
+
+	if call.Err != nil {
+		record.Status = auditStatusFailed
+		record.Error = call.Err.Error()
+	}
+
+	if err := a.write(record); err != nil {
+		log.Errorf("failed to write audit record: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const auditCommandName = "audit"
+
+const auditDateLayout = "2006-01-02"
+
+// AuditFilter selects records of the audit log, zero fields match everything.
+type AuditFilter struct {
+	since   time.Time
+	until   time.Time
+	engine  string
+	session string
+}
+
+// AuditOptions are options of "askai audit" command.
+type AuditOptions struct {
+	filter   AuditFilter
+	since    string
+	until    string
+	jsonLine bool
+}
+
+func (ao *AuditOptions) add(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&ao.since, "since", "", "Show requests made since the date (YYYY-MM-DD) or time (RFC 3339)")
+	flagSet.StringVar(&ao.until, "until", "", "Show requests made until the date (YYYY-MM-DD, inclusive) or time (RFC 3339)")
+	flagSet.StringVar(&ao.filter.engine, "e", "", "Show requests to the provider or engine, like openai or openai:gpt-4")
+	flagSet.StringVar(&ao.filter.session, "session", "", "Show requests of the session")
+	flagSet.BoolVar(&ao.jsonLine, "json", false, "Print matching records as JSONL")
+}
+
+func (ao *AuditOptions) parse(args []string) (bool, error) {
+	flagSet := newCommandFlagSet(auditCommandName)
+	ao.add(flagSet)
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	if flagSet.NArg() > 0 {
+		return false, fmt.Errorf("audit expects no arguments, got %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	var err error
+	if ao.filter.since, err = parseAuditTime(ao.since, false); err != nil {
+		return false, err
+	}
+
+	if ao.filter.until, err = parseAuditTime(ao.until, true); err != nil {
+		return false, err
+	}
+
+	ao.filter.engine = strings.ToLower(strings.TrimSpace(ao.filter.engine))
+	return true, nil
+}
+
+// parseAuditTime parses a date or time, the end of a date is its next midnight.
+func parseAuditTime(text string, endOfDate bool) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(auditDateLayout, text, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339 time", text)
+	}
+
+	if endOfDate {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+func (f AuditFilter) matches(record AuditRecord) bool {
+	if !f.since.IsZero() && record.Time.Before(f.since) {
+		return false
+	}
+
+	if !f.until.IsZero() && !record.Time.Before(f.until) {
+		return false
+	}
+
+	if f.engine != "" && f.engine != record.Provider && f.engine != record.Engine {
+		return false
+	}
+
+	return f.session == "" || f.session == record.Session
+}
+
+// runAuditCommand queries the audit log of requests sent to AI providers.
+func runAuditCommand(args []string, config *ProgramConfig) error {
+	var options AuditOptions
+	if parsed, err := options.parse(args); !parsed {
+		return err
+	}
+
+	path := expandHomeDir(config.Audit.File)
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("audit log %s is not found, enable it with '%s %s set audit.enabled true'",
+			path, programName, configCommandName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	records, err := readAuditRecords(file, options.filter)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+
+	if options.jsonLine {
+		return writeAuditRecordsJSONL(os.Stdout, records)
+	}
+
+	return printAuditRecords(os.Stdout, records)
+}
+
+func readAuditRecords(reader io.Reader, filter AuditFilter) ([]AuditRecord, error) {
+	records := make([]AuditRecord, 0)
+
+	// lines can be long when full prompts are recorded, so they aren't limited like with bufio.Scanner
+	bufReader := bufio.NewReader(reader)
+	for lineNum := 1; ; lineNum++ {
+		line, err := bufReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var record AuditRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, jsonErr)
+			}
+
+			if filter.matches(record) {
+				records = append(records, record)
+			}
+		}
+
+		if err == io.EOF {
+			return dropAnsweredSentRecords(records), nil
+		}
+	}
+}
+
+// dropAnsweredSentRecords drops records of sent requests which have a record with the result,
+// so a request is shown as sent only if it never got one, e.g. the program was stopped.
+func dropAnsweredSentRecords(records []AuditRecord) []AuditRecord {
+	type requestKey struct {
+		session string
+		request uint64
+	}
+
+	answered := make(map[requestKey]bool)
+	for _, record := range records {
+		if record.Status != auditStatusSent {
+			answered[requestKey{record.Session, record.Request}] = true
+		}
+	}
+
+	kept := make([]AuditRecord, 0, len(records))
+	for _, record := range records {
+		if record.Status == auditStatusSent && answered[requestKey{record.Session, record.Request}] {
+			continue
+		}
+		kept = append(kept, record)
+	}
+
+	return kept
+}
+
+func writeAuditRecordsJSONL(w io.Writer, records []AuditRecord) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printAuditRecords(w io.Writer, records []AuditRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSESSION\tKIND\tENGINE\tTOKENS\tDURATION\tRESULT")
+
+	for _, record := range records {
+		result := "ok"
+		if record.Error != "" {
+			result = record.Error
+		} else if record.Status == auditStatusSent {
+			result = "sent, no result recorded"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%dms\t%s\n", record.Time.Local().Format(time.DateTime), record.Session,
+			record.Kind, record.Engine, record.PromptTokens, record.ResponseTokens, record.DurationMs, result)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	savedAuditLog := auditLog
+	defer func() { auditLog = savedAuditLog }()
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	initAuditLog(AuditConfig{Enabled: true, File: path, Prompts: auditPromptsHash})
+
+	config := ProgramConfig{ProviderModel: defaultProviderModel, auditSession: "session1"}
+	message := askai.UserMessage{Prompt: "Summarize:", Context: "secret text"}
+	responseMap, err := newAIClient(config).Ask(context.Background(), []string{"echo"}, message)
+	assert.NoError(t, err)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret text")
+
+	// the request is recorded before it's sent and with its result, only the latter is shown
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"status":"sent"`)
+
+	records, err := readAuditRecords(bytes.NewReader(data), AuditFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	record := records[0]
+	assert.Equal(t, "session1", record.Session)
+	assert.Equal(t, auditStatusAnswered, record.Status)
+	assert.Equal(t, askai.CallKindAsk, record.Kind)
+	assert.Equal(t, "echo:echo", record.Engine)
+	assert.Equal(t, "echo", record.Provider)
+	assert.Equal(t, hashText(message.GetFullPrompt()), record.PromptHash)
+	assert.Empty(t, record.Prompt)
+	assert.Equal(t, []string{hashText(responseMap["echo:echo"][0])}, record.ResponseHashes)
+	assert.Greater(t, record.PromptTokens, 0)
+	assert.Empty(t, record.Error)
+
+	// a client of a command without a session gets a new one
+	initAuditLog(AuditConfig{Enabled: true, File: path, Prompts: auditPromptsFull})
+	config.auditSession = ""
+	_, err = newAIClient(config).Ask(context.Background(), []string{"echo"}, message)
+	assert.NoError(t, err)
+
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+
+	records, err = readAuditRecords(bytes.NewReader(data), AuditFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, message.GetFullPrompt(), records[1].Prompt)
+	assert.NotEqual(t, records[0].Session, records[1].Session)
+}
+
+func TestAuditLogNotWritable(t *testing.T) {
+	savedAuditLog := auditLog
+	defer func() { auditLog = savedAuditLog }()
+
+	// a file in place of the audit directory
+	dir := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(dir, nil, 0600))
+
+	initAuditLog(AuditConfig{Enabled: true, File: filepath.Join(dir, "audit.jsonl")})
+	config := ProgramConfig{ProviderModel: defaultProviderModel}
+	_, err := newAIClient(config).Ask(context.Background(), []string{"echo"}, askai.UserMessage{Prompt: "Hello"})
+	assert.Error(t, err)
+}
+
+func TestAuditSentRecords(t *testing.T) {
+	lines := []string{
+		`{"session":"s1","request":1,"status":"sent","engine":"echo:echo"}`,
+		`{"session":"s1","request":2,"status":"sent","engine":"openai:gpt-4"}`,
+		`{"session":"s1","request":1,"status":"answered","engine":"echo:echo"}`,
+		`{"session":"s2","request":2,"status":"failed","engine":"openai:gpt-4","error":"timeout"}`,
+	}
+
+	records, err := readAuditRecords(strings.NewReader(strings.Join(lines, "\n")), AuditFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	// the request which was sent, but never got a result, is kept
+	assert.Equal(t, auditStatusSent, records[0].Status)
+	assert.Equal(t, "openai:gpt-4", records[0].Engine)
+
+	var output bytes.Buffer
+	assert.NoError(t, printAuditRecords(&output, records))
+	assert.Contains(t, output.String(), "sent, no result recorded")
+	assert.Contains(t, output.String(), "timeout")
+}
+
+func TestAuditSessions(t *testing.T) {
+	savedAuditLog := auditLog
+	defer func() { auditLog = savedAuditLog }()
+
+	initAuditLog(AuditConfig{})
+	assert.Empty(t, newAuditSession())
+
+	initAuditLog(AuditConfig{Enabled: true, File: filepath.Join(t.TempDir(), "audit.jsonl")})
+	assert.NotEqual(t, newAuditSession(), newAuditSession())
+
+	// every MCP connection is a session of its own
+	config := ProgramConfig{ProviderModel: defaultProviderModel}
+	first := newMCPServer(config, io.Discard)
+	second := newMCPServer(config, io.Discard)
+	assert.NotEmpty(t, first.config.auditSession)
+	assert.NotEqual(t, first.config.auditSession, second.config.auditSession)
+}
+
+func TestProjectConfigCannotDisableAudit(t *testing.T) {
+	savedAuditLog := auditLog
+	defer func() { auditLog = savedAuditLog }()
+
+	dir := t.TempDir()
+	defaultConfig, err := getDefaultProgramConfig()
+	assert.NoError(t, err)
+	defaultLayer, err := newDefaultConfigLayer(defaultConfig)
+	assert.NoError(t, err)
+
+	userPath := filepath.Join(dir, "askai.json")
+	assert.NoError(t, os.WriteFile(userPath, []byte(`{"audit": {"enabled": true}}`), 0600))
+	userLayer, err := loadScopeConfigFileLayer(ConfigFile{scope: configScopeUser, path: userPath})
+	assert.NoError(t, err)
+
+	projectPath := filepath.Join(dir, defaultProjectConfigFileName)
+	for _, config := range []string{`{"audit": {"enabled": false}}`, `{"audit": {"file": "/dev/null"}}`} {
+		assert.NoError(t, os.WriteFile(projectPath, []byte(config), 0600))
+		_, err = loadScopeConfigFileLayer(ConfigFile{scope: configScopeProject, path: projectPath})
+		assert.Error(t, err, config)
+	}
+
+	config, err := mergeConfigLayers([]ConfigLayer{defaultLayer, userLayer}).programConfig()
+	assert.NoError(t, err)
+	initAuditLog(config.Audit)
+	assert.NotNil(t, auditLog)
+
+	// the environment is the user's, so it can turn auditing off
+	envLayers, err := loadEnvConfigLayers([]string{"ASKAI_AUDIT_ENABLED=false"})
+	assert.NoError(t, err)
+	config, err = mergeConfigLayers(append([]ConfigLayer{defaultLayer, userLayer}, envLayers...)).programConfig()
+	assert.NoError(t, err)
+	initAuditLog(config.Audit)
+	assert.Nil(t, auditLog)
+}
+
+func TestAuditFilter(t *testing.T) {
+	day := time.Date(2026, 5, 10, 12, 0, 0, 0, time.Local)
+	lines := []string{
+		`{"time":"` + day.AddDate(0, 0, -1).Format(time.RFC3339) + `","session":"s1","engine":"openai:gpt-4","provider":"openai"}`,
+		`{"time":"` + day.Format(time.RFC3339) + `","session":"s2","engine":"cohere:command","provider":"cohere"}`,
+		"",
+		`{"time":"` + day.Format(time.RFC3339) + `","session":"s2","engine":"openai:gpt-3.5-turbo","provider":"openai"}`,
+	}
+	auditData := strings.Join(lines, "\n")
+
+	var options AuditOptions
+	parsed, err := options.parse([]string{"-since", "2026-05-10", "-until", "2026-05-10"})
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+
+	records, err := readAuditRecords(strings.NewReader(auditData), options.filter)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	records, err = readAuditRecords(strings.NewReader(auditData), AuditFilter{engine: "openai"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	records, err = readAuditRecords(strings.NewReader(auditData), AuditFilter{engine: "openai:gpt-4"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	records, err = readAuditRecords(strings.NewReader(auditData), AuditFilter{session: "s2", engine: "cohere"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	options = AuditOptions{}
+	parsed, err = options.parse([]string{"-until", "2026-05-09"})
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+
+	records, err = readAuditRecords(strings.NewReader(auditData), options.filter)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = options.parse([]string{"-since", "yesterday"})
+	assert.Error(t, err)
+
+	_, err = readAuditRecords(strings.NewReader("{broken"), AuditFilter{})
+	assert.Error(t, err)
+}
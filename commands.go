@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	askCommandName  = "ask"
+	helpCommandName = "help"
+)
+
+const profileOptionName = "profile"
+
+// Command is a subcommand of the program like "askai tokens".
+type Command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string, config *ProgramConfig) error
+	flags       func(flagSet *flag.FlagSet) // adds flags of the command, if it has any
+	// the command takes an action and names before its flags, like "keys set openai -store age"
+	wordsBeforeFlags bool
+}
+
+// getCommands returns all subcommands, "ask" is the default one.
+func getCommands() []Command {
+	return []Command{
+		{
+			name:        askCommandName,
+			usage:       "[options] [prompt]",
+			description: "Ask AI engines, the default command",
+			run:         runAskCommand,
+			flags:       func(flagSet *flag.FlagSet) { (&ProgramOptions{}).add(flagSet, "") },
+		},
+		{
+			name:             configCommandName,
+			usage:            "path | show [--effective] | get <key> | set <key> <value> | unset <key> | edit | validate",
+			description:      "Show and change program configuration",
+			run:              runConfigCommand,
+			flags:            func(flagSet *flag.FlagSet) { (&ConfigOptions{}).add(flagSet) },
+			wordsBeforeFlags: true,
+		},
+		{
+			name:             keysCommandName,
+			usage:            "list | set <provider> [-store name] [-novalidate] | remove <provider> | test [provider ...]",
+			description:      "Manage API keys of AI providers",
+			run:              runKeysCommand,
+			flags:            func(flagSet *flag.FlagSet) { (&KeysOptions{}).add(flagSet, "") },
+			wordsBeforeFlags: true,
+		},
+		{
+			name:        modelsCommandName,
+			usage:       "",
+			description: "List AI providers with their models and token limits",
+			run:         runModelsCommand,
+		},
+		{
+			name:        tokensCommandName,
+			usage:       "[options] [file ...]",
+			description: "Count tokens of text and split it into chunks",
+			run:         runTokensCommand,
+			flags:       func(flagSet *flag.FlagSet) { (&TokensOptions{}).add(flagSet, "") },
+		},
+		{
+			name:        auditCommandName,
+			usage:       "[-since date] [-until date] [-e engine] [-session id] [-json]",
+			description: "Show requests sent to AI providers from the audit log",
+			run:         runAuditCommand,
+			flags:       func(flagSet *flag.FlagSet) { (&AuditOptions{}).add(flagSet) },
+		},
+		{
+			name:        serveCommandName,
+			usage:       "[-addr host:port]",
+			description: "Serve OpenAI-compatible API of AI engines over HTTP",
+			run:         runServeCommand,
+			flags:       func(flagSet *flag.FlagSet) { (&ServeOptions{}).add(flagSet, "") },
+		},
+		{
+			name:             daemonCommandName,
+			usage:            "start | stop | status [-socket path]",
+			description:      "Run background daemon which makes repeated asks faster",
+			run:              runDaemonCommand,
+			flags:            func(flagSet *flag.FlagSet) { (&DaemonOptions{}).add(flagSet, "") },
+			wordsBeforeFlags: true,
+		},
+		{
+			name:        mcpCommandName,
+			usage:       "",
+			description: "Serve AI engines as Model Context Protocol tools over stdio",
+			run:         runMCPCommand,
+		},
+		{
+			name:        helpCommandName,
+			usage:       "[command]",
+			description: "Show help of a command",
+			run:         runHelpCommand,
+		},
+	}
+}
+
+func findCommand(name string) (Command, bool) {
+	for _, command := range getCommands() {
+		if command.name == name {
+			return command, true
+		}
+	}
+
+	return Command{}, false
+}
+
+// extractProfileOption takes -profile option out of the program arguments, so it can be given
+// before the command or among its flags. Like the flags, it's looked for only up to "--" or the first
+// argument which isn't a flag or its value, so prompts and values like "-p -profile" are kept as is.
+func extractProfileOption(args []string) (string, []string, error) {
+	profile := ""
+	rest := make([]string, 0, len(args))
+
+	var command Command
+	var flagSet *flag.FlagSet
+	flagsStarted := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		isFlag := len(arg) > 1 && strings.HasPrefix(arg, "-") && arg != "--"
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if isFlag && name == profileOptionName {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return "", nil, fmt.Errorf("option -%s needs a profile name", profileOptionName)
+				}
+				i++
+				value = args[i]
+			}
+
+			profile = value
+			continue
+		}
+
+		// the command is the first argument other than -profile, see splitCommand
+		if flagSet == nil {
+			command, _ = splitCommand(args[i:])
+			flagSet = command.flagSet()
+
+			if arg == command.name {
+				rest = append(rest, arg)
+				continue
+			}
+		}
+
+		switch {
+		case isFlag:
+			flagsStarted = true
+			rest = append(rest, arg)
+			if !hasValue && flagTakesValue(flagSet, name) && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+		case arg != "--" && command.wordsBeforeFlags && !flagsStarted:
+			rest = append(rest, arg)
+		default:
+			return profile, append(rest, args[i:]...), nil
+		}
+	}
+
+	return profile, rest, nil
+}
+
+// flagSet returns the flag set with flags of the command, which are only looked up, not parsed.
+func (c Command) flagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	if c.flags != nil {
+		c.flags(flagSet)
+	}
+
+	return flagSet
+}
+
+// flagTakesValue checks if the flag is followed by its value, unknown flags are taken as switches.
+func flagTakesValue(flagSet *flag.FlagSet, name string) bool {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return false
+	}
+
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !boolFlag.IsBoolFlag()
+}
+
+// splitCommand finds the subcommand in the program arguments.
+// Arguments without a known subcommand name go to "ask" command, so "askai -e openai question" still works.
+// A prompt which is a command name goes to "ask" command as "askai ask help" or "askai -- help".
+func splitCommand(args []string) (Command, []string) {
+	if len(args) > 0 {
+		if command, exists := findCommand(args[0]); exists {
+			return command, args[1:]
+		}
+	}
+
+	command, _ := findCommand(askCommandName)
+	return command, args
+}
+
+// newCommandFlagSet makes flag set of the command which prints usage of the command on -h.
+func newCommandFlagSet(command string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(programName+" "+command, flag.ContinueOnError)
+
+	flagSet.Usage = func() {
+		printCommandUsage(flagSet.Output(), command)
+		flagSet.PrintDefaults()
+	}
+
+	return flagSet
+}
+
+// parseCommandFlags parses flags of the command, help requested by -h is not an error.
+func parseCommandFlags(flagSet *flag.FlagSet, args []string) (bool, error) {
+	err := flagSet.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func printCommandUsage(w io.Writer, name string) {
+	command, exists := findCommand(name)
+	if !exists {
+		return
+	}
+
+	fmt.Fprintf(w, "Usage: %s %s %s\n", programName, command.name, command.usage)
+	fmt.Fprintf(w, "%s.\n", command.description)
+}
+
+func printCommandsUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [options] [arguments]\n\n", programName)
+	fmt.Fprintln(w, "Commands:")
+
+	for _, command := range getCommands() {
+		fmt.Fprintf(w, "  %-8s %s\n", command.name, command.description)
+	}
+
+	fmt.Fprintf(w, "\nGlobal options:\n  -%s name\n    \tConfiguration profile to use, overrides %sPROFILE and \"profile\" config value\n",
+		profileOptionName, envConfigPrefix)
+	fmt.Fprintf(w, "\nRun '%s help <command>' or '%s <command> -h' for help of a command.\n", programName, programName)
+}
+
+func runHelpCommand(args []string, config *ProgramConfig) error {
+	if len(args) == 0 {
+		printCommandsUsage(os.Stdout)
+		return nil
+	}
+
+	name := strings.ToLower(args[0])
+	command, exists := findCommand(name)
+	if !exists {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	return command.run([]string{"-h"}, config)
+}
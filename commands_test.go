@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	command, args := splitCommand([]string{"tokens", "-e", "echo", "notes.txt"})
+	assert.Equal(t, tokensCommandName, command.name)
+	assert.Equal(t, []string{"-e", "echo", "notes.txt"}, args)
+
+	// arguments without a command go to "ask" command as before
+	command, args = splitCommand([]string{"-e", "echo", "Who am I?"})
+	assert.Equal(t, askCommandName, command.name)
+	assert.Equal(t, []string{"-e", "echo", "Who am I?"}, args)
+
+	command, args = splitCommand([]string{})
+	assert.Equal(t, askCommandName, command.name)
+	assert.Empty(t, args)
+
+	// a prompt which is a command name is asked with "ask" command or after "--"
+	command, args = splitCommand([]string{"ask", "help"})
+	assert.Equal(t, askCommandName, command.name)
+	assert.Equal(t, []string{"help"}, args)
+
+	command, args = splitCommand([]string{"--", "models"})
+	assert.Equal(t, askCommandName, command.name)
+	assert.Equal(t, []string{"--", "models"}, args)
+}
+
+func TestParseAskOptions(t *testing.T) {
+	flagSet := newCommandFlagSet(askCommandName)
+
+	var progOptions ProgramOptions
+	progOptions.add(flagSet, "cohere")
+
+	parsed, err := progOptions.parse(flagSet, []string{"-e", "echo", "-pe", "Who am I?"})
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, []string{"echo"}, progOptions.engines)
+	assert.True(t, progOptions.printAIEngine)
+	assert.Equal(t, "Who am I?", progOptions.cmdPrompt)
+
+	flagSet = newCommandFlagSet(askCommandName)
+	flagSet.SetOutput(io.Discard)
+
+	parsed, err = progOptions.parse(flagSet, []string{"-unknown"})
+	assert.Error(t, err)
+	assert.False(t, parsed)
+}
+
+func TestExtractProfileOption(t *testing.T) {
+	profile, args, err := extractProfileOption([]string{"-profile", "work", "tokens", "notes.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "work", profile)
+	assert.Equal(t, []string{"tokens", "notes.txt"}, args)
+
+	profile, args, err = extractProfileOption([]string{"-e", "echo", "--profile=personal", "--", "-profile", "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "personal", profile)
+	assert.Equal(t, []string{"-e", "echo", "--", "-profile", "x"}, args)
+
+	_, _, err = extractProfileOption([]string{"-profile"})
+	assert.Error(t, err)
+
+	tests := []struct {
+		args    []string
+		profile string
+		rest    []string
+	}{
+		// values of flags and prompts are kept even if they look like -profile
+		{[]string{"-p", "-profile", "x"}, "", []string{"-p", "-profile", "x"}},
+		{[]string{"-pp", "-profile", "work", "question"}, "work", []string{"-pp", "question"}},
+		{[]string{"what", "is", "-profile", "x"}, "", []string{"what", "is", "-profile", "x"}},
+		{[]string{"-profile", "work", "-p=-profile"}, "work", []string{"-p=-profile"}},
+		{[]string{"tokens", "-e", "echo", "-profile", "work", "notes.txt"}, "work", []string{"tokens", "-e", "echo", "notes.txt"}},
+		{[]string{"tokens", "notes.txt", "-profile", "work"}, "", []string{"tokens", "notes.txt", "-profile", "work"}},
+		{[]string{"tokens", "-ct", "-profile"}, "", []string{"tokens", "-ct", "-profile"}},
+		{[]string{"audit", "-json", "-profile", "work"}, "work", []string{"audit", "-json"}},
+		// actions and names go before flags of some commands
+		{[]string{"keys", "set", "openai", "-profile", "work", "-novalidate"}, "work", []string{"keys", "set", "openai", "-novalidate"}},
+		{[]string{"config", "show", "--effective", "-profile", "work"}, "work", []string{"config", "show", "--effective"}},
+		{[]string{"config", "get", "--", "-profile", "work"}, "", []string{"config", "get", "--", "-profile", "work"}},
+		{[]string{"ask", "-profile", "work", "-", "-profile", "x"}, "work", []string{"ask", "-", "-profile", "x"}},
+	}
+
+	for _, test := range tests {
+		profile, rest, err := extractProfileOption(test.args)
+		assert.NoError(t, err, test.args)
+		assert.Equal(t, test.profile, profile, test.args)
+		assert.Equal(t, test.rest, rest, test.args)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"golang.org/x/term"
+	xwidth "golang.org/x/text/width"
+)
+
+const (
+	compareFormatColumns  = "columns"
+	compareFormatMarkdown = "markdown"
+	compareFormatHTML     = "html"
+)
+
+const defaultTerminalWidth = 120
+const minColumnWidth = 20
+const columnSeparator = " | "
+
+// EngineStats holds the answer of an engine along with its statistics.
+type EngineStats struct {
+	engine         string
+	engineKey      string
+	responses      []string
+	err            error
+	latency        time.Duration
+	promptTokens   int
+	responseTokens int
+}
+
+func (s EngineStats) name() string {
+	if s.engineKey != "" {
+		return s.engineKey
+	}
+
+	return s.engine
+}
+
+func (s EngineStats) answer() string {
+	if s.err != nil {
+		return fmt.Sprintf("error: %v", s.err)
+	}
+
+	return strings.TrimSpace(strings.Join(s.responses, "\n"))
+}
+
+func (s EngineStats) summary() []string {
+	return []string{
+		fmt.Sprintf("latency: %s", s.latency.Round(time.Millisecond)),
+		fmt.Sprintf("tokens: %d prompt, %d response", s.promptTokens, s.responseTokens),
+		fmt.Sprintf("length: %d chars", utf8.RuneCountInString(s.answer())),
+	}
+}
+
+func isValidCompareFormat(format string) bool {
+	return format == compareFormatColumns || format == compareFormatMarkdown || format == compareFormatHTML
+}
+
+// compareEngines asks all engines simultaneously and collects their answers with statistics.
+func compareEngines(ctx context.Context, engines []string, message askai.UserMessage, config ProgramConfig) []EngineStats {
+	client := newAIClient(config)
+	runEngines := commandEngines(config)
+	statsChannel := make(chan EngineStats, len(engines))
+
+	processEngineAsync := func(engine string) {
+		start := time.Now()
+		callResult := client.AskChain(ctx, engine, message)
+		stats := EngineStats{
+			engine:    engine,
+			engineKey: callResult.EngineKey,
+			responses: callResult.Responses,
+			err:       callResult.Err,
+			latency:   time.Since(start),
+		}
+
+		if callResult.Err == nil {
+			stats.promptTokens, stats.responseTokens = countAnswerTokens(runEngines, callResult.EngineKey, message,
+				callResult.Responses)
+		}
+
+		statsChannel <- stats
+	}
+
+	for _, engine := range engines {
+		go processEngineAsync(engine)
+	}
+
+	allStats := make([]EngineStats, 0, len(engines))
+	for i := 0; i != len(engines); i++ {
+		allStats = append(allStats, <-statsChannel)
+	}
+
+	sort.Slice(allStats, func(i, j int) bool {
+		return allStats[i].name() < allStats[j].name()
+	})
+
+	return allStats
+}
+
+// countAnswerTokens counts tokens of prompt and responses with the tokenizer of the engine which answered,
+// it's taken from engines of the run, so tokens are counted the way the run counted them.
+func countAnswerTokens(runEngines map[string]askai.AIEngine, engineKey string, message askai.UserMessage,
+	responses []string) (int, int) {
+	aiProvider, aiModel, err := askai.SplitEngineName(engineKey)
+	if err != nil {
+		return 0, 0
+	}
+
+	engine, exists := runEngines[aiProvider]
+	if !exists {
+		return 0, 0
+	}
+
+	promptTokens, _ := engine.CalcTokenNum(aiModel, message.GetFullPrompt())
+
+	responseTokens := 0
+	for _, response := range responses {
+		tokenNum, _ := engine.CalcTokenNum(aiModel, response)
+		responseTokens += tokenNum
+	}
+
+	return promptTokens, responseTokens
+}
+
+func printComparison(w io.Writer, allStats []EngineStats, format string, diffEngines string) error {
+	var diff []diffOp
+	if diffEngines != "" {
+		var err error
+		diff, err = diffEngineAnswers(allStats, diffEngines)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case compareFormatMarkdown:
+		printComparisonMarkdown(w, allStats, diff)
+	case compareFormatHTML:
+		printComparisonHTML(w, allStats, diff)
+	default:
+		printComparisonColumns(w, allStats, diff)
+	}
+
+	return nil
+}
+
+func getTerminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return defaultTerminalWidth
+	}
+
+	return width
+}
+
+// runeWidth returns the number of terminal columns the rune takes, East Asian wide characters take two.
+func runeWidth(r rune) int {
+	switch xwidth.LookupRune(r).Kind() {
+	case xwidth.EastAsianWide, xwidth.EastAsianFullwidth:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func runesWidth(runes []rune) int {
+	width := 0
+	for _, r := range runes {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// fittingRunes returns the number of leading runes which take at most width columns and their width,
+// at least one rune is taken, so a wide character always makes progress.
+func fittingRunes(runes []rune, width int) (int, int) {
+	n, taken := 0, 0
+	for n < len(runes) && (n == 0 || taken+runeWidth(runes[n]) <= width) {
+		taken += runeWidth(runes[n])
+		n++
+	}
+
+	return n, taken
+}
+
+// wrapText splits text into lines which take at most width terminal columns, breaking at spaces where possible.
+func wrapText(text string, width int) []string {
+	lines := make([]string, 0)
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := make([]rune, 0, width)
+		lineWidth := 0
+
+		for _, word := range strings.Fields(paragraph) {
+			runes := []rune(word)
+			wordWidth := runesWidth(runes)
+
+			if lineWidth > 0 && lineWidth+1+wordWidth > width {
+				lines = append(lines, string(line))
+				line, lineWidth = line[:0], 0
+			}
+
+			for wordWidth > width && len(runes) > 1 {
+				if lineWidth > 0 {
+					lines = append(lines, string(line))
+					line, lineWidth = line[:0], 0
+				}
+
+				n, partWidth := fittingRunes(runes, width)
+				lines = append(lines, string(runes[:n]))
+				runes, wordWidth = runes[n:], wordWidth-partWidth
+			}
+
+			if lineWidth > 0 {
+				line = append(line, ' ')
+				lineWidth++
+			}
+			line = append(line, runes...)
+			lineWidth += wordWidth
+		}
+
+		lines = append(lines, string(line))
+	}
+
+	return lines
+}
+
+func padRight(text string, width int) string {
+	padding := width - runesWidth([]rune(text))
+	if padding <= 0 {
+		return text
+	}
+
+	return text + strings.Repeat(" ", padding)
+}
+
+func printComparisonColumns(w io.Writer, allStats []EngineStats, diff []diffOp) {
+	if len(allStats) == 0 {
+		return
+	}
+
+	separatorsWidth := len(columnSeparator) * (len(allStats) - 1)
+	columnWidth := (getTerminalWidth() - separatorsWidth) / len(allStats)
+	if columnWidth < minColumnWidth {
+		columnWidth = minColumnWidth
+	}
+
+	columns := make([][]string, len(allStats))
+	height := 0
+
+	for i, stats := range allStats {
+		column := wrapText(stats.name(), columnWidth)
+		for _, line := range stats.summary() {
+			column = append(column, wrapText(line, columnWidth)...)
+		}
+		column = append(column, strings.Repeat("-", columnWidth))
+		column = append(column, wrapText(stats.answer(), columnWidth)...)
+
+		columns[i] = column
+		if len(column) > height {
+			height = len(column)
+		}
+	}
+
+	for row := 0; row != height; row++ {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			if row < len(column) {
+				cells[i] = padRight(column[row], columnWidth)
+			} else {
+				cells[i] = padRight("", columnWidth)
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, columnSeparator), " "))
+	}
+
+	if diff != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, formatWordDiff(diff, "[-", "-]", "{+", "+}"))
+	}
+}
+
+// markdownTextEscaper escapes characters Markdown renderers take for HTML.
+var markdownTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// markdownCellEscaper also keeps the text in one cell of a table.
+var markdownCellEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "|", "\\|", "\n", "<br>")
+
+func escapeMarkdownCell(text string) string {
+	return markdownCellEscaper.Replace(text)
+}
+
+func printComparisonMarkdown(w io.Writer, allStats []EngineStats, diff []diffOp) {
+	fmt.Fprintln(w, "| Engine | Latency | Prompt tokens | Response tokens | Length | Answer |")
+	fmt.Fprintln(w, "|---|---|---|---|---|---|")
+
+	for _, stats := range allStats {
+		answer := stats.answer()
+		fmt.Fprintf(w, "| %s | %s | %d | %d | %d | %s |\n",
+			escapeMarkdownCell(stats.name()), stats.latency.Round(time.Millisecond),
+			stats.promptTokens, stats.responseTokens, utf8.RuneCountInString(answer),
+			escapeMarkdownCell(answer))
+	}
+
+	if diff != nil {
+		for i := range diff {
+			diff[i].text = markdownTextEscaper.Replace(diff[i].text)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, formatWordDiff(diff, "~~", "~~", "**", "**"))
+	}
+}
+
+func printComparisonHTML(w io.Writer, allStats []EngineStats, diff []diffOp) {
+	fmt.Fprintln(w, "<table>")
+	fmt.Fprintln(w, "<tr><th>Engine</th><th>Latency</th><th>Prompt tokens</th>"+
+		"<th>Response tokens</th><th>Length</th><th>Answer</th></tr>")
+
+	for _, stats := range allStats {
+		answer := stats.answer()
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td>"+
+			"<td style=\"white-space: pre-wrap\">%s</td></tr>\n",
+			html.EscapeString(stats.name()), stats.latency.Round(time.Millisecond),
+			stats.promptTokens, stats.responseTokens, utf8.RuneCountInString(answer),
+			html.EscapeString(answer))
+	}
+
+	fmt.Fprintln(w, "</table>")
+
+	if diff != nil {
+		for i := range diff {
+			diff[i].text = html.EscapeString(diff[i].text)
+		}
+		fmt.Fprintf(w, "<p>%s</p>\n", formatWordDiff(diff, "<del>", "</del>", "<ins>", "</ins>"))
+	}
+}
+
+// findEngineStats finds stats by engine key or by the engine name it was requested with.
+func findEngineStats(allStats []EngineStats, name string) (EngineStats, bool) {
+	for _, stats := range allStats {
+		if stats.engineKey == name || stats.engine == name {
+			return stats, true
+		}
+	}
+
+	for _, stats := range allStats {
+		aiProvider, _, _ := askai.SplitEngineName(stats.engineKey)
+		if aiProvider == name {
+			return stats, true
+		}
+	}
+
+	return EngineStats{}, false
+}
+
+func diffEngineAnswers(allStats []EngineStats, diffEngines string) ([]diffOp, error) {
+	names := strings.Split(diffEngines, ",")
+	if len(names) != 2 {
+		return nil, fmt.Errorf("two engines separated by comma are expected to diff, got %q", diffEngines)
+	}
+
+	answers := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		stats, found := findEngineStats(allStats, name)
+		if !found {
+			return nil, fmt.Errorf("no answer of engine %s to diff", name)
+		}
+
+		answers = append(answers, stats.answer())
+	}
+
+	return wordDiff(answers[0], answers[1]), nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testComparisonStats() []EngineStats {
+	return []EngineStats{
+		{engine: "echo", engineKey: "echo:echo", responses: []string{"a | b < c & d"}, latency: 1500 * time.Millisecond,
+			promptTokens: 3, responseTokens: 5},
+		{engine: "mock", engineKey: "mock:mock", err: errors.New("failed <badly>")},
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		lines []string
+	}{
+		{"short text", 20, []string{"short text"}},
+		{"", 5, []string{""}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"first\n\nsecond", 10, []string{"first", "", "second"}},
+		// multibyte characters take a column each
+		{"привет мир", 6, []string{"привет", "мир"}},
+		// wide characters take two columns
+		{"日本語のテキスト", 6, []string{"日本語", "のテキ", "スト"}},
+		{"ab 日本", 4, []string{"ab", "日本"}},
+		{"日本", 1, []string{"日", "本"}},
+	}
+
+	for _, test := range tests {
+		lines := wrapText(test.text, test.width)
+		assert.Equal(t, test.lines, lines, test.text)
+
+		for _, line := range lines {
+			if len([]rune(line)) > 1 {
+				assert.LessOrEqual(t, runesWidth([]rune(line)), test.width, line)
+			}
+		}
+	}
+}
+
+func TestPadRight(t *testing.T) {
+	assert.Equal(t, "ab  ", padRight("ab", 4))
+	assert.Equal(t, "日本", padRight("日本", 4))
+	assert.Equal(t, "日 ", padRight("日", 3))
+	assert.Equal(t, "toolong", padRight("toolong", 3))
+}
+
+func TestPrintComparisonColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []EngineStats
+		diff  string
+		want  []string
+	}{
+		{"empty", nil, "", nil},
+		{"errors", testComparisonStats(), "", []string{"echo:echo", "mock:mock", "latency: 1.5s", "error: failed <badly>"}},
+		{"wide", []EngineStats{{engineKey: "echo:echo", responses: []string{strings.Repeat("日本語 ", 40)}},
+			{engineKey: "mock:mock", responses: []string{"short"}}}, "", []string{"日本語"}},
+		{"diff", testComparisonStats(), "echo,mock", []string{"[-a | b < c & d-]"}},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		assert.NoError(t, printComparison(&output, test.stats, compareFormatColumns, test.diff), test.name)
+
+		if test.stats == nil {
+			assert.Empty(t, output.String(), test.name)
+			continue
+		}
+
+		for _, want := range test.want {
+			assert.Contains(t, output.String(), want, test.name)
+		}
+
+		// columns are aligned, whatever characters they have
+		columnWidth := (defaultTerminalWidth - len(columnSeparator)) / 2
+		for _, line := range strings.Split(output.String(), "\n") {
+			if separator := strings.LastIndex(line, columnSeparator); separator > 0 && !strings.HasPrefix(line, "[-") {
+				assert.Equal(t, columnWidth, runesWidth([]rune(line[:separator])), test.name)
+			}
+		}
+	}
+}
+
+func TestPrintComparisonMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []EngineStats
+		diff  string
+		want  string
+	}{
+		{"empty", nil, "", "| Engine | Latency | Prompt tokens | Response tokens | Length | Answer |\n|---|---|---|---|---|---|\n"},
+		{"escaped", testComparisonStats(), "",
+			"| Engine | Latency | Prompt tokens | Response tokens | Length | Answer |\n|---|---|---|---|---|---|\n" +
+				"| echo:echo | 1.5s | 3 | 5 | 13 | a \\| b &lt; c &amp; d |\n" +
+				"| mock:mock | 0s | 0 | 0 | 21 | error: failed &lt;badly&gt; |\n"},
+		{"multiline", []EngineStats{{engineKey: "echo:echo", responses: []string{"line 1\nline 2"}}}, "",
+			"| Engine | Latency | Prompt tokens | Response tokens | Length | Answer |\n|---|---|---|---|---|---|\n" +
+				"| echo:echo | 0s | 0 | 0 | 13 | line 1<br>line 2 |\n"},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		assert.NoError(t, printComparison(&output, test.stats, compareFormatMarkdown, test.diff), test.name)
+		assert.Equal(t, test.want, output.String(), test.name)
+	}
+
+	var output bytes.Buffer
+	assert.NoError(t, printComparison(&output, testComparisonStats(), compareFormatMarkdown, "echo,mock"))
+	assert.Contains(t, output.String(), "\n~~a | b &lt; c &amp; d~~ **error: failed &lt;badly&gt;**\n")
+}
+
+func TestPrintComparisonHTML(t *testing.T) {
+	const header = "<table>\n<tr><th>Engine</th><th>Latency</th><th>Prompt tokens</th>" +
+		"<th>Response tokens</th><th>Length</th><th>Answer</th></tr>\n"
+
+	tests := []struct {
+		name  string
+		stats []EngineStats
+		diff  string
+		want  string
+	}{
+		{"empty", nil, "", header + "</table>\n"},
+		{"escaped", testComparisonStats(), "", header +
+			"<tr><td>echo:echo</td><td>1.5s</td><td>3</td><td>5</td><td>13</td>" +
+			"<td style=\"white-space: pre-wrap\">a | b &lt; c &amp; d</td></tr>\n" +
+			"<tr><td>mock:mock</td><td>0s</td><td>0</td><td>0</td><td>21</td>" +
+			"<td style=\"white-space: pre-wrap\">error: failed &lt;badly&gt;</td></tr>\n" +
+			"</table>\n"},
+		{"diff", testComparisonStats()[:1], "echo,echo", header +
+			"<tr><td>echo:echo</td><td>1.5s</td><td>3</td><td>5</td><td>13</td>" +
+			"<td style=\"white-space: pre-wrap\">a | b &lt; c &amp; d</td></tr>\n" +
+			"</table>\n<p>a | b &lt; c &amp; d</p>\n"},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		assert.NoError(t, printComparison(&output, test.stats, compareFormatHTML, test.diff), test.name)
+		assert.Equal(t, test.want, output.String(), test.name)
+	}
+}
+
+func TestDiffEngineAnswers(t *testing.T) {
+	tests := []struct {
+		name        string
+		stats       []EngineStats
+		diffEngines string
+		err         string
+	}{
+		{"no answers", nil, "echo,mock", "no answer of engine echo"},
+		{"one answer", testComparisonStats()[:1], "echo,mock", "no answer of engine mock"},
+		{"one engine", testComparisonStats(), "echo", "two engines"},
+		{"three engines", testComparisonStats(), "echo,mock,openai", "two engines"},
+		{"by provider", testComparisonStats(), "echo, MOCK", ""},
+		{"by engine key", testComparisonStats(), "echo:echo,mock:mock", ""},
+	}
+
+	for _, test := range tests {
+		diff, err := diffEngineAnswers(test.stats, test.diffEngines)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.name)
+			continue
+		}
+
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, "[-a | b < c & d-] {+error: failed <badly>+}", formatWordDiff(diff, "[-", "-]", "{+", "+}"), test.name)
+	}
+}
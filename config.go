@@ -1,62 +1,374 @@
 package main
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 
+	"github.com/ilia-funtov/askai/pkg/askai"
 	log "github.com/sirupsen/logrus"
 )
 
 type ProgramConfig struct {
-	APIKeys               map[string]string `json:"apikeys"`
-	Engine                string            `json:"engine"`
-	SummarizePrompt       string            `json:"summarizeprompt"`
-	ProviderModel         map[string]string `json:"providermodel"`
-	PrintAIEngineTemplate string            `json:"printaiengine"`
-	LogLevel              string            `json:"loglevel"`
-	LogDir                string            `json:"logdir"`
-	LogFormatter          string            `json:"logformat"`
-	configFilePath        string            // don't serialize this
+	APIKeys               map[string]string        `json:"apikeys"`
+	KeyStore              string                   `json:"keystore"`
+	Engine                string                   `json:"engine"`
+	SummarizePrompt       string                   `json:"summarizeprompt"`
+	ProviderModel         map[string]string        `json:"providermodel"`
+	PrintAIEngineTemplate string                   `json:"printaiengine"`
+	LogLevel              string                   `json:"loglevel"`
+	LogDir                string                   `json:"logdir"`
+	LogFormatter          string                   `json:"logformat"`
+	LogPrompts            string                   `json:"logprompts"`
+	LogMaxSize            int                      `json:"logmaxsize"`
+	LogMaxAge             int                      `json:"logmaxage"`
+	LogMaxBackups         int                      `json:"logmaxbackups"`
+	FallbackPolicy        string                   `json:"fallbackpolicy"`
+	JudgePrompt           string                   `json:"judgeprompt"`
+	Tokenizer             TokenizerConfig          `json:"tokenizer"`
+	Mock                  askai.MockConfig         `json:"mock"`
+	Redaction             RedactionConfig          `json:"redaction"`
+	Audit                 AuditConfig              `json:"audit"`
+	Telemetry             TelemetryConfig          `json:"telemetry"`
+	Serve                 ServeConfig              `json:"serve"`
+	Profile               string                   `json:"profile"`
+	Profiles              map[string]ProfileConfig `json:"profiles"`
+	configFilePath        string                   // don't serialize this
+	auditSession          string                   // audit session of the command, see newAuditSession
 }
 
-func initProgramConfig() (*ProgramConfig, error) {
+// ProfileConfig is a named set of settings like "work" or "personal" which override
+// the rest of the configuration when the profile is selected.
+type ProfileConfig struct {
+	Engine          string            `json:"engine"`
+	ProviderModel   map[string]string `json:"providermodel"`
+	APIKeys         map[string]string `json:"apikeys"`
+	SummarizePrompt string            `json:"summarizeprompt"`
+	JudgePrompt     string            `json:"judgeprompt"`
+	FallbackPolicy  string            `json:"fallbackpolicy"`
+	LogLevel        string            `json:"loglevel"`
+	LogDir          string            `json:"logdir"`
+	LogFormatter    string            `json:"logformat"`
+}
+
+// TokenizerConfig configures tokenizers: encoding files are loaded the same way by the whole program,
+// the rest is set per engine.
+type TokenizerConfig struct {
+	CacheDir    string `json:"cachedir"`
+	Offline     bool   `json:"offline"`
+	Fallback    string `json:"fallback"`
+	ContentType string `json:"contenttype"`
+	Overlap     int    `json:"overlap"`
+}
+
+// encodingCache returns settings of loading encoding files, see askai.InitTokenizers.
+func (c TokenizerConfig) encodingCache() askai.EncodingCacheConfig {
+	return askai.EncodingCacheConfig{CacheDir: c.CacheDir, Offline: c.Offline}
+}
+
+// tokenizer returns settings tokenizers of engines are created with.
+func (c TokenizerConfig) tokenizer() askai.TokenizerConfig {
+	return askai.TokenizerConfig{Fallback: c.Fallback, ContentType: c.ContentType, Overlap: c.Overlap}
+}
+
+// configProfile is the profile selected by -profile option, it takes precedence over ASKAI_PROFILE
+// and "profile" config value.
+var configProfile string
+
+// getUserConfigFilePath returns path of the config file in the user's program directory.
+func getUserConfigFilePath() (string, error) {
 	userProgramDir, err := getProgramUserDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userProgramDir, defaultConfigDir, programName+"."+defaultConfigFileExtension), nil
+}
+
+// getDefaultProgramConfig returns configuration with built-in default values.
+func getDefaultProgramConfig() (ProgramConfig, error) {
+	userProgramDir, err := getProgramUserDir()
+	if err != nil {
+		return ProgramConfig{}, err
+	}
+
+	providerModel := make(map[string]string, len(defaultProviderModel))
+	for aiProvider, aiModel := range defaultProviderModel {
+		providerModel[aiProvider] = aiModel
+	}
+
+	config := ProgramConfig{
+		Engine:                defaultEngine,
+		SummarizePrompt:       defaultSummarizePrompt,
+		ProviderModel:         providerModel,
+		PrintAIEngineTemplate: defaultPrintAIEngineTemplate,
+		LogDir:                filepath.Join(userProgramDir, defaultLogDir),
+		FallbackPolicy:        defaultFallbackPolicy,
+		JudgePrompt:           defaultJudgePrompt,
+		KeyStore:              defaultKeyStore,
+		LogPrompts:            defaultLogPrompts,
+		LogMaxSize:            defaultLogMaxSize,
+		LogMaxAge:             defaultLogMaxAge,
+		LogMaxBackups:         defaultLogMaxBackups,
+	}
+
+	config.Tokenizer.Fallback = defaultTokenizerFallback
+	config.Redaction.Secrets = true
+	config.Audit.File = filepath.Join(userProgramDir, defaultAuditDir, defaultAuditFileName)
+	config.Audit.Prompts = auditPromptsHash
+	config.Telemetry.Endpoint = defaultTelemetryEndpoint
+	config.Serve.Addr = defaultServeAddr
+	config.Tokenizer.CacheDir = filepath.Join(userProgramDir, defaultCacheDir, defaultTiktokenCacheDir)
+
+	return config, nil
+}
+
+const (
+	configScopeSystem  = "system"
+	configScopeUser    = "user"
+	configScopeProject = "project"
+)
+
+// ConfigFile is a config file of one of the scopes: system, user or project.
+type ConfigFile struct {
+	scope string
+	path  string
+}
+
+func getSystemConfigFilePath() string {
+	return filepath.Join(defaultSystemConfigDir, programName+"."+defaultConfigFileExtension)
+}
+
+// findProjectConfigFile looks for project config file in the directory and its parents.
+func findProjectConfigFile(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, defaultProjectConfigFileName)
+		if fileInfo, err := os.Stat(path); err == nil && !fileInfo.IsDir() {
+			return path, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// getConfigFiles returns config files in the order of precedence, project config file is included if it's found.
+func getConfigFiles() ([]ConfigFile, error) {
+	userConfigFilePath, err := getUserConfigFilePath()
 	if err != nil {
 		return nil, err
 	}
 
-	configDir := filepath.Join(
-		userProgramDir,
-		defaultConfigDir)
+	configFiles := []ConfigFile{
+		{scope: configScopeSystem, path: getSystemConfigFilePath()},
+		{scope: configScopeUser, path: userConfigFilePath},
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	if projectConfigFilePath, found := findProjectConfigFile(workDir); found {
+		configFiles = append(configFiles, ConfigFile{scope: configScopeProject, path: projectConfigFilePath})
+	}
+
+	return configFiles, nil
+}
+
+// getScopeConfigFilePath returns path of the config file of the scope. If there is no project config file,
+// it's the one in the working directory.
+func getScopeConfigFilePath(scope string) (string, error) {
+	configFiles, err := getConfigFiles()
+	if err != nil {
+		return "", err
+	}
+
+	for _, configFile := range configFiles {
+		if configFile.scope == scope {
+			return configFile.path, nil
+		}
+	}
+
+	if scope != configScopeProject {
+		return "", fmt.Errorf("unknown config scope: %s", scope)
+	}
 
-	var config ProgramConfig
+	workDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
 
-	config.configFilePath = filepath.Join(
-		configDir,
-		programName+"."+defaultConfigFileExtension)
+	return filepath.Join(workDir, defaultProjectConfigFileName), nil
+}
 
-	config.Engine = defaultEngine
-	config.SummarizePrompt = defaultSummarizePrompt
-	config.ProviderModel = defaultProviderModel
-	config.PrintAIEngineTemplate = defaultPrintAIEngineTemplate
+// projectConfigKeys are the keys project config files can set: the engine, models, prompts and output
+// options. Project config files come with repositories, which aren't trusted like the user, so they can't
+// set API keys, choose where files are written or commands are read from, or weaken redaction, auditing,
+// telemetry and prompt logging.
+var projectConfigKeys = map[string]bool{
+	"engine":                true,
+	"summarizeprompt":       true,
+	"judgeprompt":           true,
+	"fallbackpolicy":        true,
+	"printaiengine":         true,
+	"tokenizer.contenttype": true,
+	"tokenizer.overlap":     true,
+	profileConfigKey:        true,
+}
 
-	data, err := os.ReadFile(config.configFilePath)
-	if err == nil {
-		err = json.Unmarshal(data, &config)
+// isProjectConfigKey checks if the key can be set by project config files, keys
+// of profiles like "profiles.work.engine" are checked as keys of the configuration.
+func isProjectConfigKey(key string) bool {
+	names := strings.Split(key, configKeySeparator)
+	if len(names) > 2 && names[0] == profilesConfigKey {
+		names = names[2:]
+	}
 
+	if len(names) == 2 && names[0] == "providermodel" {
+		return true
+	}
+
+	return projectConfigKeys[strings.Join(names, configKeySeparator)]
+}
+
+// loadScopeConfigFileLayer loads config file of the scope, project config files
+// can set only keys of projectConfigKeys as they come with repositories.
+func loadScopeConfigFileLayer(configFile ConfigFile) (ConfigLayer, error) {
+	layer, err := loadConfigFileLayer(configFile.path)
+	if err != nil {
+		return layer, err
+	}
+
+	if configFile.scope == configScopeProject {
+		if err = checkProjectConfigLayer(layer); err != nil {
+			return layer, err
+		}
+	}
+
+	return layer, nil
+}
+
+func checkProjectConfigLayer(layer ConfigLayer) error {
+	for key := range layer.values {
+		if !isProjectConfigKey(key) {
+			return fmt.Errorf("invalid config file %s: %s can't be set in project config file", layer.source, key)
+		}
+	}
+
+	return nil
+}
+
+// loadConfigLayers loads configuration layers in the order of precedence: built-in defaults,
+// system, user and project config files, the selected profile and ASKAI_* environment variables.
+func loadConfigLayers() ([]ConfigLayer, error) {
+	defaultConfig, err := getDefaultProgramConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLayer, err := newDefaultConfigLayer(defaultConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := []ConfigLayer{defaultLayer}
+
+	configFiles, err := getConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, configFile := range configFiles {
+		fileLayer, err := loadScopeConfigFileLayer(configFile)
 		if err != nil {
-			log.Warningf("failed to deserialize config file: %v", err)
+			return nil, err
 		}
-	} else {
-		log.Warningf("failed to read config file: %v", err)
+
+		layers = append(layers, fileLayer)
+	}
+
+	envLayers, err := loadEnvConfigLayers(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	profile := configProfile
+	if profile == "" {
+		base := mergeConfigLayers(append(layers, envLayers...))
+		profile, _ = base[profileConfigKey].value.(string)
+	}
+
+	if profile != "" {
+		profileLayer, err := newProfileConfigLayer(mergeConfigLayers(layers), profile)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, profileLayer)
+	}
+
+	layers = append(layers, envLayers...)
+
+	if configProfile != "" {
+		flagLayer := newConfigLayer("flag -" + profileOptionName)
+		flagLayer.values[profileConfigKey] = configProfile
+		layers = append(layers, flagLayer)
+	}
+
+	return layers, nil
+}
+
+// validateConfigProfiles checks that every profile makes valid configuration, not only the selected one.
+func validateConfigProfiles(layers []ConfigLayer) error {
+	base := mergeConfigLayers(layers)
+
+	for _, profile := range base.profiles() {
+		profileLayer, err := newProfileConfigLayer(base, profile)
+		if err != nil {
+			return err
+		}
+
+		if _, err = mergeConfigLayers(append(layers, profileLayer)).programConfig(); err != nil {
+			return fmt.Errorf("invalid profile %s: %w", profile, err)
+		}
+	}
+
+	return nil
+}
+
+func initProgramConfig() (*ProgramConfig, error) {
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := mergeConfigLayers(layers).programConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.configFilePath, err = getUserConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultConfig, err := getDefaultProgramConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	if config.LogDir == "" {
-		config.LogDir = filepath.Join(
-			userProgramDir,
-			defaultLogDir)
+		config.LogDir = defaultConfig.LogDir
+	}
+
+	if config.Tokenizer.CacheDir == "" {
+		config.Tokenizer.CacheDir = defaultConfig.Tokenizer.CacheDir
 	}
 
 	initLoggingToFile(config)
@@ -64,24 +376,56 @@ func initProgramConfig() (*ProgramConfig, error) {
 	return &config, nil
 }
 
+// initAPIKeysConfig resolves API keys of the used engines, which can be references to secrets,
+// and asks user for the missing ones.
 func initAPIKeysConfig(progOptions ProgramOptions, config *ProgramConfig) error {
-	newAPIKeys, err := processMissedAPIKeys(config.APIKeys, progOptions.engines)
+	apiKeys, err := resolveAPIKeys(config.APIKeys, progOptions.usedEngines())
 	if err != nil {
 		return err
 	}
 
-	if !reflect.DeepEqual(config.APIKeys, newAPIKeys) {
-		config.APIKeys = newAPIKeys
+	newAPIKeys, err := processMissedAPIKeys(apiKeys, progOptions.usedEngines())
+	if err != nil {
+		return err
+	}
 
-		data, err := json.MarshalIndent(config, "", " ")
-		if err == nil {
-			err = os.WriteFile(config.configFilePath, data, 0600)
+	if !reflect.DeepEqual(apiKeys, newAPIKeys) {
+		err = saveAPIKeys(config.configFilePath, config.KeyStore, apiKeys, newAPIKeys)
+		if err != nil {
+			log.Warningf("failed to save API keys: %v", err)
 		}
+	}
+
+	config.APIKeys = newAPIKeys
+	for _, apiKey := range newAPIKeys {
+		addLogSecret(apiKey)
+	}
+
+	return nil
+}
 
+// saveAPIKeys saves API keys which were entered by user to the key store and references to them
+// to the config file, other settings of the file are kept.
+func saveAPIKeys(configFilePath string, keyStore string, oldAPIKeys map[string]string, newAPIKeys map[string]string) error {
+	layer, err := loadConfigFileLayer(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	for aiProvider, apiKey := range newAPIKeys {
+		if oldAPIKey, exists := oldAPIKeys[aiProvider]; exists && oldAPIKey == apiKey {
+			continue
+		}
+
+		value, err := storeAPIKey(keyStore, aiProvider, apiKey)
 		if err != nil {
-			log.Warningf("failed to write to config file: %v", err)
+			return err
+		}
+
+		if value != "" {
+			layer.values[joinConfigKey("apikeys", aiProvider)] = value
 		}
 	}
 
-	return nil
+	return saveConfigFileLayer(layer)
 }
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+)
+
+const configCommandName = "config"
+
+const maskedKeyVisibleChars = 4
+
+const defaultEditor = "vi"
+
+// ConfigOptions are options of "askai config" command.
+type ConfigOptions struct {
+	action       string
+	args         []string
+	effective    bool
+	scope        string
+	aiEngineList string
+	contentType  string
+}
+
+func (co *ConfigOptions) add(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&co.effective, "effective", false, "Show every value of the configuration in effect with its source")
+	flagSet.StringVar(&co.scope, "scope", configScopeUser, "Config file to change with set, unset and edit: system, user or project")
+	flagSet.StringVar(&co.aiEngineList, "e", "", "Engine flag of ask command to take into account in show --effective")
+	flagSet.StringVar(&co.contentType, "ct", "", "Content type flag of ask command to take into account in show --effective")
+}
+
+func (co *ConfigOptions) parse(args []string) (bool, error) {
+	// the action goes first, so flags after it like "show --effective" are parsed
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		co.action = args[0]
+		args = args[1:]
+	}
+
+	flagSet := newCommandFlagSet(configCommandName)
+	co.add(flagSet)
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	co.args = flagSet.Args()
+	if co.action == "" {
+		co.action = "show"
+	}
+
+	co.scope = strings.ToLower(co.scope)
+	if co.scope != configScopeSystem && co.scope != configScopeUser && co.scope != configScopeProject {
+		return false, fmt.Errorf("unknown config scope: %s", co.scope)
+	}
+
+	argNums := map[string]int{"path": 0, "show": 0, "edit": 0, "validate": 0, "get": 1, "unset": 1, "set": 2}
+
+	argNum, exists := argNums[co.action]
+	if !exists {
+		return false, fmt.Errorf("unknown config action: %s", co.action)
+	}
+
+	if len(co.args) != argNum {
+		return false, fmt.Errorf("config %s expects %d arguments, got %d", co.action, argNum, len(co.args))
+	}
+
+	return true, nil
+}
+
+// flagConfigLayers makes layers of ask command flags which override config values.
+func (co *ConfigOptions) flagConfigLayers() []ConfigLayer {
+	layers := make([]ConfigLayer, 0)
+
+	if co.aiEngineList != "" {
+		layer := newConfigLayer("flag -e")
+		layer.values["engine"] = strings.ToLower(co.aiEngineList)
+		layers = append(layers, layer)
+	}
+
+	if co.contentType != "" {
+		layer := newConfigLayer("flag -ct")
+		layer.values["tokenizer.contenttype"] = strings.ToLower(co.contentType)
+		layers = append(layers, layer)
+	}
+
+	return layers
+}
+
+// runConfigCommand shows and changes the configuration. It doesn't use the loaded configuration,
+// so a broken config file can be fixed with it.
+func runConfigCommand(args []string, config *ProgramConfig) error {
+	var options ConfigOptions
+	if parsed, err := options.parse(args); !parsed {
+		return err
+	}
+
+	configFilePath, err := getScopeConfigFilePath(options.scope)
+	if err != nil {
+		return err
+	}
+
+	configFile := ConfigFile{scope: options.scope, path: configFilePath}
+
+	switch options.action {
+	case "path":
+		return printConfigFiles(os.Stdout)
+	case "show":
+		return showConfig(os.Stdout, options)
+	case "get":
+		return getConfigValue(os.Stdout, options.args[0])
+	case "set":
+		return setConfigValue(configFile, options.args[0], options.args[1])
+	case "unset":
+		return unsetConfigValue(configFile, options.args[0])
+	case "edit":
+		return editConfigFile(configFile)
+	case "validate":
+		return validateConfig(os.Stdout)
+	}
+
+	return nil
+}
+
+func validateConfig(w io.Writer) error {
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return err
+	}
+
+	if _, err = mergeConfigLayers(layers).programConfig(); err != nil {
+		return err
+	}
+
+	if err = validateConfigProfiles(layers); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, "Configuration is valid")
+	return err
+}
+
+// loadEffectiveConfig merges all configuration layers with the extra ones and validates the result.
+func loadEffectiveConfig(extraLayers []ConfigLayer) (EffectiveConfig, error) {
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	effective := mergeConfigLayers(append(layers, extraLayers...))
+	if _, err = effective.programConfig(); err != nil {
+		return nil, err
+	}
+
+	return effective, nil
+}
+
+// isSecretConfigKey reports whether the key holds an API key, like "apikeys.openai" or "profiles.work.apikeys.openai".
+func isSecretConfigKey(key string) bool {
+	if key == joinConfigKey("serve", "token") {
+		return true
+	}
+
+	names := strings.Split(key, configKeySeparator)
+	return len(names) >= 2 && names[len(names)-2] == "apikeys"
+}
+
+// formatConfigValue formats the value for output, secrets are masked, references to them are not.
+func formatConfigValue(key string, value interface{}) string {
+	if s, ok := value.(string); ok && isSecretConfigKey(key) {
+		value = maskSecretValue(s)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
+
+// showConfig prints the configuration in effect as JSON or, with --effective, every value with its source.
+func showConfig(w io.Writer, options ConfigOptions) error {
+	effective, err := loadEffectiveConfig(options.flagConfigLayers())
+	if err != nil {
+		return err
+	}
+
+	if options.effective {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+
+		for _, key := range effective.keys() {
+			value := effective[key]
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", key, formatConfigValue(key, value.value), value.source)
+		}
+
+		return tw.Flush()
+	}
+
+	config, err := effective.programConfig()
+	if err != nil {
+		return err
+	}
+
+	return printConfig(w, config)
+}
+
+// printConfig prints the configuration as JSON, API keys are masked.
+func printConfig(w io.Writer, config ProgramConfig) error {
+	apiKeys := make(map[string]string, len(config.APIKeys))
+	for aiProvider, apiKey := range config.APIKeys {
+		apiKeys[aiProvider] = maskSecretValue(apiKey)
+	}
+	config.APIKeys = apiKeys
+	config.Serve.Token = maskSecretValue(config.Serve.Token)
+
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func getConfigValue(w io.Writer, key string) error {
+	if _, err := leafConfigKeyType(key); err != nil {
+		return err
+	}
+
+	effective, err := loadEffectiveConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	value, exists := effective[key]
+	if !exists {
+		return fmt.Errorf("config key %s is not set", key)
+	}
+
+	if s, ok := value.value.(string); ok {
+		if isSecretConfigKey(key) {
+			s = maskSecretValue(s)
+		}
+		_, err = fmt.Fprintln(w, s)
+	} else {
+		_, err = fmt.Fprintln(w, formatConfigValue(key, value.value))
+	}
+
+	return err
+}
+
+// printConfigFiles prints paths of config files in the order of precedence.
+func printConfigFiles(w io.Writer) error {
+	configFiles, err := getConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, configFile := range configFiles {
+		state := ""
+		if _, err = os.Stat(configFile.path); os.IsNotExist(err) {
+			state = "(not found)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", configFile.scope, configFile.path, state)
+	}
+
+	return tw.Flush()
+}
+
+// updateConfigFile changes values of the config file and saves it if the resulting configuration is valid.
+func updateConfigFile(configFile ConfigFile, update func(layer ConfigLayer) error) error {
+	fileLayer, err := loadConfigFileLayer(configFile.path)
+	if err != nil {
+		return fmt.Errorf("%w, fix it with '%s %s edit -scope %s'", err, programName, configCommandName, configFile.scope)
+	}
+
+	if err = update(fileLayer); err != nil {
+		return err
+	}
+
+	if configFile.scope == configScopeProject {
+		if err = checkProjectConfigLayer(fileLayer); err != nil {
+			return err
+		}
+	}
+
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range layers {
+		if layers[i].source == configFile.path {
+			layers[i] = fileLayer
+			replaced = true
+		}
+	}
+
+	// a new project config file takes precedence over user config file
+	if !replaced {
+		layers = append(layers, fileLayer)
+	}
+
+	if _, err = mergeConfigLayers(layers).programConfig(); err != nil {
+		return err
+	}
+
+	if err = validateConfigProfiles(layers); err != nil {
+		return err
+	}
+
+	return saveConfigFileLayer(fileLayer)
+}
+
+func setConfigValue(configFile ConfigFile, key string, text string) error {
+	value, err := parseConfigValue(key, text)
+	if err != nil {
+		return err
+	}
+
+	return updateConfigFile(configFile, func(layer ConfigLayer) error {
+		layer.values[key] = value
+		return nil
+	})
+}
+
+// unsetConfigValue removes the key from the config file, so its default value is used.
+// Removing a section removes all its keys.
+func unsetConfigValue(configFile ConfigFile, key string) error {
+	if _, err := configKeyType(key); err != nil {
+		return err
+	}
+
+	return updateConfigFile(configFile, func(layer ConfigLayer) error {
+		removed := 0
+		for valueKey := range layer.values {
+			if valueKey == key || strings.HasPrefix(valueKey, key+configKeySeparator) {
+				delete(layer.values, valueKey)
+				removed++
+			}
+		}
+
+		if removed == 0 {
+			return fmt.Errorf("config key %s is not set in %s", key, configFile.path)
+		}
+
+		return nil
+	})
+}
+
+// editConfigFile opens the config file in $VISUAL or $EDITOR and validates it after editing.
+func editConfigFile(configFile ConfigFile) error {
+	configFilePath := configFile.path
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		if err = saveConfigFileLayer(newConfigLayer(configFilePath)); err != nil {
+			return err
+		}
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	editorArgs := strings.Fields(editor)
+	cmd := exec.Command(editorArgs[0], append(editorArgs[1:], configFilePath)...) //nolint:gosec // editor is chosen by user
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run editor: %w", err)
+	}
+
+	if _, err := loadEffectiveConfig(nil); err != nil {
+		return fmt.Errorf("configuration is invalid after editing: %w", err)
+	}
+
+	return nil
+}
+
+// maskAPIKey hides all but the last characters of API key.
+func maskAPIKey(apiKey string) string {
+	if len(apiKey) <= 2*maskedKeyVisibleChars {
+		return "****"
+	}
+
+	return "****" + apiKey[len(apiKey)-maskedKeyVisibleChars:]
+}
+
+// maskSecretValue masks API key given in config, references to secrets like "env:OPENAI_API_KEY" are kept.
+func maskSecretValue(value string) string {
+	if isSecretReference(value) {
+		return value
+	}
+
+	return maskAPIKey(value)
+}
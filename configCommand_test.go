@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskAPIKey(t *testing.T) {
+	assert.Equal(t, "****cdef", maskAPIKey("sk-0123456789abcdef"))
+	assert.Equal(t, "****", maskAPIKey("short"))
+}
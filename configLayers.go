@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+)
+
+const configKeySeparator = "."
+
+const envConfigPrefix = "ASKAI_"
+
+const defaultConfigSource = "default"
+
+const (
+	profileConfigKey  = "profile"
+	profilesConfigKey = "profiles"
+)
+
+// ConfigLayer is a set of configuration values from one source like a config file or environment variables.
+// Keys are paths of JSON fields of ProgramConfig like "tokenizer.cachedir" or "apikeys.openai".
+type ConfigLayer struct {
+	source string
+	values map[string]interface{}
+}
+
+// ConfigValue is a value of the merged configuration along with the source it came from.
+type ConfigValue struct {
+	value  interface{}
+	source string
+}
+
+// EffectiveConfig is the result of merging configuration layers, later layers override earlier ones.
+type EffectiveConfig map[string]ConfigValue
+
+var errUnknownConfigKey = errors.New("unknown config key")
+
+var configSchema = buildConfigSchema(reflect.TypeOf(ProgramConfig{}), "", make(map[string]reflect.Type))
+
+// jsonFieldName returns name of the field in JSON, empty for fields which are not serialized.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if !field.IsExported() || name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+func findJSONField(structType reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		if field := structType.Field(i); jsonFieldName(field) == name {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// buildConfigSchema maps keys of all JSON fields of the structure, including nested ones, to their types.
+func buildConfigSchema(structType reflect.Type, prefix string, schema map[string]reflect.Type) map[string]reflect.Type {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		key := joinConfigKey(prefix, name)
+		schema[key] = field.Type
+
+		if field.Type.Kind() == reflect.Struct {
+			buildConfigSchema(field.Type, key, schema)
+		}
+	}
+
+	return schema
+}
+
+func joinConfigKey(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + configKeySeparator + name
+}
+
+// configKeyType returns type of the config key, keys of map fields like "apikeys.openai"
+// or "profiles.work.engine" have type of the map values or their fields.
+func configKeyType(key string) (reflect.Type, error) {
+	keyType := reflect.TypeOf(ProgramConfig{})
+
+	for _, name := range strings.Split(key, configKeySeparator) {
+		found := false
+
+		switch keyType.Kind() {
+		case reflect.Struct:
+			var field reflect.StructField
+			if field, found = findJSONField(keyType, name); found {
+				keyType = field.Type
+			}
+		case reflect.Map:
+			keyType = keyType.Elem()
+			found = name != ""
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errUnknownConfigKey, key)
+		}
+	}
+
+	return keyType, nil
+}
+
+// leafConfigKeyType returns type of the config key which holds a single value, not a section.
+func leafConfigKeyType(key string) (reflect.Type, error) {
+	keyType, err := configKeyType(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind := keyType.Kind(); kind == reflect.Struct || kind == reflect.Map {
+		return nil, fmt.Errorf("config key %s is a section, use one of its keys", key)
+	}
+
+	return keyType, nil
+}
+
+// convertConfigValue checks that the value decoded from JSON fits the type of the key and converts it.
+func convertConfigValue(key string, keyType reflect.Type, value interface{}) (interface{}, error) {
+	invalid := fmt.Errorf("invalid value of config key %s: %v is not %s", key, value, keyType.Kind())
+
+	switch keyType.Kind() {
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case reflect.Int:
+		switch number := value.(type) {
+		case int:
+			return number, nil
+		case float64:
+			if number == math.Trunc(number) {
+				return int(number), nil
+			}
+		}
+	case reflect.Float64:
+		switch number := value.(type) {
+		case int:
+			return float64(number), nil
+		case float64:
+			return number, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type of config key %s: %s", key, keyType)
+	}
+
+	return nil, invalid
+}
+
+// parseConfigValue parses value of the config key given as a string in command line or environment variable.
+func parseConfigValue(key string, text string) (interface{}, error) {
+	keyType, err := leafConfigKeyType(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch keyType.Kind() {
+	case reflect.Bool:
+		value, err = strconv.ParseBool(text)
+	case reflect.Int:
+		value, err = strconv.Atoi(text)
+	case reflect.Float64:
+		value, err = strconv.ParseFloat(text, 64)
+	default:
+		value = text
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of config key %s: %q is not %s", key, text, keyType.Kind())
+	}
+
+	return value, nil
+}
+
+// flattenConfigJSON converts JSON object of configuration into flat values keyed by paths.
+func flattenConfigJSON(prefix string, data map[string]interface{}, values map[string]interface{}) error {
+	for name, value := range data {
+		key := joinConfigKey(prefix, name)
+
+		keyType, err := configKeyType(key)
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			continue
+		}
+
+		if kind := keyType.Kind(); kind == reflect.Struct || kind == reflect.Map {
+			section, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid value of config key %s: an object is expected", key)
+			}
+
+			if err = flattenConfigJSON(key, section, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		values[key], err = convertConfigValue(key, keyType, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unflattenConfigValues converts flat values keyed by paths into JSON object of configuration.
+func unflattenConfigValues(values map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+
+	for key, value := range values {
+		section := data
+		names := strings.Split(key, configKeySeparator)
+
+		for _, name := range names[:len(names)-1] {
+			nested, ok := section[name].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				section[name] = nested
+			}
+			section = nested
+		}
+
+		section[names[len(names)-1]] = value
+	}
+
+	return data
+}
+
+func newConfigLayer(source string) ConfigLayer {
+	return ConfigLayer{source: source, values: make(map[string]interface{})}
+}
+
+// newDefaultConfigLayer makes layer of built-in default values.
+func newDefaultConfigLayer(config ProgramConfig) (ConfigLayer, error) {
+	layer := newConfigLayer(defaultConfigSource)
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return layer, fmt.Errorf("failed to serialize default config: %w", err)
+	}
+
+	var object map[string]interface{}
+	if err = json.Unmarshal(data, &object); err != nil {
+		return layer, fmt.Errorf("failed to deserialize default config: %w", err)
+	}
+
+	return layer, flattenConfigJSON("", object, layer.values)
+}
+
+// loadConfigFileLayer reads config file, missing file makes an empty layer.
+func loadConfigFileLayer(path string) (ConfigLayer, error) {
+	layer := newConfigLayer(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return layer, nil
+	}
+
+	if err != nil {
+		return layer, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return layer, nil
+	}
+
+	var object map[string]interface{}
+	if err = json.Unmarshal(data, &object); err != nil {
+		return layer, fmt.Errorf("failed to deserialize config file %s: %w", path, err)
+	}
+
+	if err = flattenConfigJSON("", object, layer.values); err != nil {
+		return layer, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return layer, nil
+}
+
+// saveConfigFileLayer writes values of the layer to its config file.
+func saveConfigFileLayer(layer ConfigLayer) error {
+	data, err := json.MarshalIndent(unflattenConfigValues(layer.values), "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+
+	const dirPermissionMask = 0770
+	if err = os.MkdirAll(filepath.Dir(layer.source), dirPermissionMask); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	const configPermissionMask = 0600
+	if err = os.WriteFile(layer.source, append(data, '\n'), configPermissionMask); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// envConfigName returns name of environment variable overriding the config key, like ASKAI_TOKENIZER_CACHEDIR.
+func envConfigName(key string) string {
+	return envConfigPrefix + strings.ToUpper(strings.ReplaceAll(key, configKeySeparator, "_"))
+}
+
+// loadEnvConfigLayers takes values of config keys from ASKAI_* environment variables, a layer per variable.
+// Keys of map sections are taken by prefix, e.g. ASKAI_PROVIDERMODEL_OPENAI sets providermodel.openai.
+func loadEnvConfigLayers(environ []string) ([]ConfigLayer, error) {
+	layers := make([]ConfigLayer, 0)
+
+	keysByName := make(map[string]string)
+	mapPrefixes := make(map[string]string)
+	for key, keyType := range configSchema {
+		switch keyType.Kind() {
+		case reflect.Struct:
+		case reflect.Map:
+			// sections of maps like profiles are set by names of their keys, e.g. ASKAI_PROFILE
+			if kind := keyType.Elem().Kind(); kind != reflect.Struct && kind != reflect.Map {
+				mapPrefixes[envConfigName(key)+"_"] = key
+			}
+		default:
+			keysByName[envConfigName(key)] = key
+		}
+	}
+
+	for _, variable := range environ {
+		name, text, found := strings.Cut(variable, "=")
+		if !found || !strings.HasPrefix(name, envConfigPrefix) {
+			continue
+		}
+
+		key, exists := keysByName[name]
+		if !exists {
+			for prefix, mapKey := range mapPrefixes {
+				if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+					key = joinConfigKey(mapKey, strings.ToLower(name[len(prefix):]))
+				}
+			}
+		}
+
+		if key == "" {
+			continue
+		}
+
+		value, err := parseConfigValue(key, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment variable %s: %w", name, err)
+		}
+
+		layer := newConfigLayer("env " + name)
+		layer.values[key] = value
+		layers = append(layers, layer)
+	}
+
+	sort.Slice(layers, func(i, j int) bool {
+		return layers[i].source < layers[j].source
+	})
+
+	return layers, nil
+}
+
+// mergeConfigLayers merges layers in the given order, so values of later layers win.
+func mergeConfigLayers(layers []ConfigLayer) EffectiveConfig {
+	effective := make(EffectiveConfig)
+
+	for _, layer := range layers {
+		for key, value := range layer.values {
+			effective[key] = ConfigValue{value: value, source: layer.source}
+		}
+	}
+
+	return effective
+}
+
+// newProfileConfigLayer makes layer of values of the profile, so they override values of the base configuration.
+func newProfileConfigLayer(effective EffectiveConfig, profile string) (ConfigLayer, error) {
+	layer := newConfigLayer("profile " + profile)
+
+	prefix := joinConfigKey(profilesConfigKey, profile) + configKeySeparator
+	for key, value := range effective {
+		if strings.HasPrefix(key, prefix) {
+			layer.values[strings.TrimPrefix(key, prefix)] = value.value
+		}
+	}
+
+	if len(layer.values) == 0 {
+		return layer, fmt.Errorf("profile %s is not defined", profile)
+	}
+
+	return layer, nil
+}
+
+// profiles returns names of profiles defined in the configuration in alphabetical order.
+func (ec EffectiveConfig) profiles() []string {
+	names := make(map[string]bool)
+
+	prefix := profilesConfigKey + configKeySeparator
+	for key := range ec {
+		if strings.HasPrefix(key, prefix) {
+			names[strings.Split(strings.TrimPrefix(key, prefix), configKeySeparator)[0]] = true
+		}
+	}
+
+	profiles := make([]string, 0, len(names))
+	for name := range names {
+		profiles = append(profiles, name)
+	}
+
+	sort.Strings(profiles)
+	return profiles
+}
+
+// keys returns config keys in alphabetical order.
+func (ec EffectiveConfig) keys() []string {
+	keys := make([]string, 0, len(ec))
+	for key := range ec {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// programConfig makes ProgramConfig of the merged values and validates it.
+func (ec EffectiveConfig) programConfig() (ProgramConfig, error) {
+	values := make(map[string]interface{}, len(ec))
+	for key, value := range ec {
+		values[key] = value.value
+	}
+
+	var config ProgramConfig
+
+	data, err := json.Marshal(unflattenConfigValues(values))
+	if err != nil {
+		return config, fmt.Errorf("failed to serialize config: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to deserialize config: %w", err)
+	}
+
+	return config, validateProgramConfig(config)
+}
+
+// validateProgramConfig checks values which have a limited set of choices or a format.
+func validateProgramConfig(config ProgramConfig) error {
+	for _, engine := range askai.ExpandEngineChains(strings.Split(config.Engine, ",")) {
+		aiProvider, _, _ := askai.SplitEngineName(engine)
+		if _, exists := engineMap[aiProvider]; !exists {
+			return fmt.Errorf("invalid value of config key engine: unknown engine %s", aiProvider)
+		}
+	}
+
+	switch config.FallbackPolicy {
+	case askai.FallbackPolicyRetryable, askai.FallbackPolicyAny, askai.FallbackPolicyNone:
+	default:
+		return fmt.Errorf("invalid value of config key fallbackpolicy: %q, expected %s, %s or %s",
+			config.FallbackPolicy, askai.FallbackPolicyRetryable, askai.FallbackPolicyAny, askai.FallbackPolicyNone)
+	}
+
+	if config.LogLevel != "" {
+		if _, err := log.ParseLevel(config.LogLevel); err != nil {
+			return fmt.Errorf("invalid value of config key loglevel: %w", err)
+		}
+	}
+
+	if !isValidKeyStore(config.KeyStore) {
+		return fmt.Errorf("invalid value of config key keystore: %q, expected %s, %s, %s, %s or %s", config.KeyStore,
+			keyStoreAuto, keyStoreKeyring, keyStoreAge, keyStoreConfig, keyStoreNone)
+	}
+
+	if config.LogFormatter != "" && config.LogFormatter != "json" && config.LogFormatter != "text" {
+		return fmt.Errorf("invalid value of config key logformat: %q, expected json or text", config.LogFormatter)
+	}
+
+	if config.LogPrompts != "" && !askai.IsValidLogPromptMode(config.LogPrompts) {
+		return fmt.Errorf("invalid value of config key logprompts: %q, expected %s, %s or %s",
+			config.LogPrompts, askai.LogPromptsHash, askai.LogPromptsTruncate, askai.LogPromptsFull)
+	}
+
+	if config.LogMaxSize < 0 || config.LogMaxAge < 0 || config.LogMaxBackups < 0 {
+		return fmt.Errorf("invalid value of config keys logmaxsize, logmaxage or logmaxbackups: negative number")
+	}
+
+	return validateTokenizerAndMockConfig(config)
+}
+
+func validateTokenizerAndMockConfig(config ProgramConfig) error {
+	tokenizer := config.Tokenizer
+	if tokenizer.Fallback != askai.TokenizerFallbackRough && tokenizer.Fallback != askai.TokenizerFallbackError {
+		return fmt.Errorf("invalid value of config key tokenizer.fallback: %q, expected %s or %s",
+			tokenizer.Fallback, askai.TokenizerFallbackRough, askai.TokenizerFallbackError)
+	}
+
+	if tokenizer.ContentType != "" && !askai.IsValidContentType(tokenizer.ContentType) {
+		return fmt.Errorf("invalid value of config key tokenizer.contenttype: unknown content type %q", tokenizer.ContentType)
+	}
+
+	if tokenizer.Overlap < 0 {
+		return fmt.Errorf("invalid value of config key tokenizer.overlap: %d is negative", tokenizer.Overlap)
+	}
+
+	mock := config.Mock
+	if mock.Latency != "" {
+		if _, err := time.ParseDuration(mock.Latency); err != nil {
+			return fmt.Errorf("invalid value of config key mock.latency: %w", err)
+		}
+	}
+
+	if mock.ErrorRate < 0 || mock.ErrorRate > 1 {
+		return fmt.Errorf("invalid value of config key mock.errorrate: %v is not in [0, 1]", mock.ErrorRate)
+	}
+
+	if mock.MaxTokens < 0 {
+		return fmt.Errorf("invalid value of config key mock.maxtokens: %d is negative", mock.MaxTokens)
+	}
+
+	if err := validateRedactionConfig(config.Redaction); err != nil {
+		return err
+	}
+
+	if err := validateAuditConfig(config.Audit); err != nil {
+		return err
+	}
+
+	if err := validateTelemetryConfig(config.Telemetry); err != nil {
+		return err
+	}
+
+	return validateServeConfig(config.Serve)
+}
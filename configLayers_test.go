@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenConfigJSON(t *testing.T) {
+	data := map[string]interface{}{
+		"engine":    "openai",
+		"apikeys":   map[string]interface{}{"openai": "sk-test"},
+		"tokenizer": map[string]interface{}{"overlap": float64(10), "offline": true},
+	}
+
+	values := make(map[string]interface{})
+	assert.NoError(t, flattenConfigJSON("", data, values))
+	assert.Equal(t, map[string]interface{}{
+		"engine":            "openai",
+		"apikeys.openai":    "sk-test",
+		"tokenizer.overlap": 10,
+		"tokenizer.offline": true,
+	}, values)
+
+	assert.Equal(t, map[string]interface{}{"overlap": 10, "offline": true}, unflattenConfigValues(values)["tokenizer"])
+
+	err := flattenConfigJSON("", map[string]interface{}{"engin": "openai"}, values)
+	assert.ErrorIs(t, err, errUnknownConfigKey)
+
+	err = flattenConfigJSON("", map[string]interface{}{"tokenizer": map[string]interface{}{"overlap": "ten"}}, values)
+	assert.Error(t, err)
+
+	err = flattenConfigJSON("", map[string]interface{}{"tokenizer": "rough"}, values)
+	assert.Error(t, err)
+}
+
+func TestParseConfigValue(t *testing.T) {
+	value, err := parseConfigValue("tokenizer.offline", "true")
+	assert.NoError(t, err)
+	assert.Equal(t, true, value)
+
+	value, err = parseConfigValue("mock.errorrate", "0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, value)
+
+	value, err = parseConfigValue("providermodel.openai", "gpt-4")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4", value)
+
+	_, err = parseConfigValue("tokenizer.overlap", "many")
+	assert.Error(t, err)
+
+	_, err = parseConfigValue("tokenizer", "rough")
+	assert.Error(t, err)
+
+	_, err = parseConfigValue("unknown", "1")
+	assert.ErrorIs(t, err, errUnknownConfigKey)
+}
+
+func TestLoadEnvConfigLayers(t *testing.T) {
+	layers, err := loadEnvConfigLayers([]string{
+		"ASKAI_ENGINE=echo",
+		"ASKAI_APIKEYS_OPENAI=sk-test",
+		"ASKAI_TOKENIZER_OVERLAP=5",
+		"ASKAI_UNKNOWN=1",
+		"HOME=/home/user",
+	})
+	assert.NoError(t, err)
+
+	effective := mergeConfigLayers(layers)
+	assert.Equal(t, ConfigValue{value: "echo", source: "env ASKAI_ENGINE"}, effective["engine"])
+	assert.Equal(t, ConfigValue{value: "sk-test", source: "env ASKAI_APIKEYS_OPENAI"}, effective["apikeys.openai"])
+	assert.Equal(t, ConfigValue{value: 5, source: "env ASKAI_TOKENIZER_OVERLAP"}, effective["tokenizer.overlap"])
+	assert.Len(t, effective, 3)
+
+	_, err = loadEnvConfigLayers([]string{"ASKAI_TOKENIZER_OFFLINE=maybe"})
+	assert.Error(t, err)
+}
+
+func TestMergeConfigLayers(t *testing.T) {
+	defaultLayer, err := newDefaultConfigLayer(ProgramConfig{
+		Engine:         "cohere",
+		ProviderModel:  map[string]string{"openai": "gpt-3.5-turbo", "cohere": "command"},
+		KeyStore:       keyStoreAuto,
+		FallbackPolicy: askai.FallbackPolicyRetryable,
+		Tokenizer:      TokenizerConfig{Fallback: askai.TokenizerFallbackRough},
+	})
+	assert.NoError(t, err)
+
+	fileLayer := newConfigLayer("askai.json")
+	fileLayer.values["engine"] = "openai"
+	fileLayer.values["providermodel.openai"] = "gpt-4"
+
+	flagLayer := newConfigLayer("flag -e")
+	flagLayer.values["engine"] = "echo"
+
+	effective := mergeConfigLayers([]ConfigLayer{defaultLayer, fileLayer, flagLayer})
+	assert.Equal(t, ConfigValue{value: "echo", source: "flag -e"}, effective["engine"])
+	assert.Equal(t, "askai.json", effective["providermodel.openai"].source)
+	assert.Equal(t, defaultConfigSource, effective["providermodel.cohere"].source)
+
+	config, err := effective.programConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "echo", config.Engine)
+	assert.Equal(t, map[string]string{"openai": "gpt-4", "cohere": "command"}, config.ProviderModel)
+
+	fileLayer.values["fallbackpolicy"] = "sometimes"
+	_, err = mergeConfigLayers([]ConfigLayer{defaultLayer, fileLayer}).programConfig()
+	assert.Error(t, err)
+}
+
+func TestConfigFileLayerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "askai.json")
+
+	layer, err := loadConfigFileLayer(path)
+	assert.NoError(t, err)
+	assert.Empty(t, layer.values)
+
+	layer.values["engine"] = "echo"
+	layer.values["mock.maxtokens"] = 100
+	assert.NoError(t, saveConfigFileLayer(layer))
+
+	loaded, err := loadConfigFileLayer(path)
+	assert.NoError(t, err)
+	assert.Equal(t, layer.values, loaded.values)
+}
+
+func TestProfileConfigLayer(t *testing.T) {
+	fileLayer := newConfigLayer("askai.json")
+	fileLayer.values["engine"] = "cohere"
+	fileLayer.values["profiles.work.engine"] = "openai"
+	fileLayer.values["profiles.work.providermodel.openai"] = "gpt-4"
+	fileLayer.values["profiles.personal.engine"] = "cohere"
+
+	effective := mergeConfigLayers([]ConfigLayer{fileLayer})
+	assert.Equal(t, []string{"personal", "work"}, effective.profiles())
+
+	profileLayer, err := newProfileConfigLayer(effective, "work")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"engine": "openai", "providermodel.openai": "gpt-4"}, profileLayer.values)
+
+	effective = mergeConfigLayers([]ConfigLayer{fileLayer, profileLayer})
+	assert.Equal(t, ConfigValue{value: "openai", source: "profile work"}, effective["engine"])
+
+	_, err = newProfileConfigLayer(effective, "unknown")
+	assert.Error(t, err)
+}
+
+func TestConfigKeyType(t *testing.T) {
+	for _, key := range []string{"engine", "apikeys.openai", "profiles.work.engine", "profiles.work.apikeys.openai", "tokenizer.overlap"} {
+		_, err := leafConfigKeyType(key)
+		assert.NoError(t, err, key)
+	}
+
+	for _, key := range []string{"engin", "apikeys.", "profiles.work.tokenizer", "tokenizer.overlap.x"} {
+		_, err := leafConfigKeyType(key)
+		assert.Error(t, err, key)
+	}
+
+	assert.True(t, isSecretConfigKey("profiles.work.apikeys.openai"))
+	assert.False(t, isSecretConfigKey("providermodel.openai"))
+}
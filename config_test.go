@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindProjectConfigFile(t *testing.T) {
+	root := t.TempDir()
+	subDir := filepath.Join(root, "a", "b")
+	assert.NoError(t, os.MkdirAll(subDir, 0700))
+
+	_, found := findProjectConfigFile(subDir)
+	assert.False(t, found)
+
+	configPath := filepath.Join(root, "a", defaultProjectConfigFileName)
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"engine": "echo"}`), 0600))
+
+	path, found := findProjectConfigFile(subDir)
+	assert.True(t, found)
+	assert.Equal(t, configPath, path)
+
+	layer, err := loadScopeConfigFileLayer(ConfigFile{scope: configScopeProject, path: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "echo", layer.values["engine"])
+}
+
+func TestProjectConfigRejectsAPIKeys(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), defaultProjectConfigFileName)
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"apikeys": {"openai": "sk-test"}}`), 0600))
+
+	_, err := loadScopeConfigFileLayer(ConfigFile{scope: configScopeProject, path: configPath})
+	assert.Error(t, err)
+
+	layer, err := loadScopeConfigFileLayer(ConfigFile{scope: configScopeUser, path: configPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test", layer.values["apikeys.openai"])
+}
+
+func TestProjectConfigAllowsOnlyHarmlessKeys(t *testing.T) {
+	allowed := `{"engine": "openai>cohere", "providermodel": {"openai": "gpt-4"}, "summarizeprompt": "Shorten:",
+		"judgeprompt": "Judge:", "fallbackpolicy": "any", "printaiengine": "{{.Engine}}",
+		"tokenizer": {"contenttype": "code", "overlap": 10}, "profile": "work",
+		"profiles": {"work": {"engine": "cohere", "providermodel": {"cohere": "command"}}}}`
+	configPath := filepath.Join(t.TempDir(), defaultProjectConfigFileName)
+	assert.NoError(t, os.WriteFile(configPath, []byte(allowed), 0600))
+
+	_, err := loadScopeConfigFileLayer(ConfigFile{scope: configScopeProject, path: configPath})
+	assert.NoError(t, err)
+
+	rejected := []string{
+		`{"serve": {"token": "secret"}}`,
+		`{"serve": {"addr": "0.0.0.0:8080"}}`,
+		`{"redaction": {"secrets": false}}`,
+		`{"logprompts": "full"}`,
+		`{"audit": {"enabled": false}}`,
+		`{"telemetry": {"enabled": true}}`,
+		`{"keystore": "file"}`,
+		`{"logdir": "/tmp"}`,
+		`{"tokenizer": {"cachedir": "/tmp"}}`,
+		`{"mock": {"responsesfile": "/tmp/responses.json"}}`,
+		`{"profiles": {"work": {"apikeys": {"openai": "sk-test"}}}}`,
+		`{"profiles": {"work": {"logdir": "/tmp"}}}`,
+	}
+
+	for _, config := range rejected {
+		assert.NoError(t, os.WriteFile(configPath, []byte(config), 0600))
+
+		_, err = loadScopeConfigFileLayer(ConfigFile{scope: configScopeProject, path: configPath})
+		assert.Error(t, err, config)
+
+		_, err = loadScopeConfigFileLayer(ConfigFile{scope: configScopeUser, path: configPath})
+		assert.NoError(t, err, config)
+	}
+}
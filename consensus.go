@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+const voteEngineKey = "vote"
+
+// formatJudgeContext lists the question and answers of all engines for the judge engine.
+func formatJudgeContext(question string, responseMap map[string][]string) string {
+	var sb strings.Builder
+
+	sb.WriteString("Question:\n")
+	sb.WriteString(question)
+	sb.WriteString("\n")
+
+	engineKeys := maps.Keys(responseMap)
+	sort.Strings(engineKeys)
+
+	for i, engineKey := range engineKeys {
+		for _, response := range responseMap[engineKey] {
+			response = strings.TrimSpace(response)
+			if response == "" {
+				continue
+			}
+
+			fmt.Fprintf(&sb, "\nAnswer %d:\n%s\n", i+1, response)
+		}
+	}
+
+	return sb.String()
+}
+
+// judgeResponses asks the judge engine to merge answers of several engines into a single one.
+func judgeResponses(ctx context.Context, judge string, message askai.UserMessage, responseMap map[string][]string,
+	config ProgramConfig) askai.EngineCallResult {
+	judgeMessage := askai.UserMessage{
+		Prompt:  config.JudgePrompt,
+		Context: formatJudgeContext(message.GetFullPrompt(), responseMap),
+	}
+
+	callResult := newAIClient(config).AskChain(ctx, judge, judgeMessage)
+	if callResult.Err != nil {
+		callResult.Err = fmt.Errorf("judge %s failed: %w", judge, callResult.Err)
+	}
+
+	return callResult
+}
+
+func normalizeVote(response string) string {
+	response = strings.ToLower(strings.TrimSpace(response))
+	return strings.TrimRightFunc(response, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+// voteResponses chooses the most common answer of engines, answers are compared
+// ignoring case and trailing punctuation. It's intended for short classification-style answers.
+func voteResponses(responseMap map[string][]string) (string, int, error) {
+	engineKeys := maps.Keys(responseMap)
+	sort.Strings(engineKeys)
+
+	votes := make(map[string]int)
+	answers := make(map[string]string)
+	order := make([]string, 0, len(engineKeys))
+
+	for _, engineKey := range engineKeys {
+		responses := responseMap[engineKey]
+		if len(responses) == 0 {
+			continue
+		}
+
+		// every engine has one vote
+		answer := strings.TrimSpace(responses[0])
+		vote := normalizeVote(answer)
+		if vote == "" {
+			continue
+		}
+
+		if _, exists := votes[vote]; !exists {
+			answers[vote] = answer
+			order = append(order, vote)
+		}
+		votes[vote]++
+	}
+
+	if len(order) == 0 {
+		return "", 0, fmt.Errorf("no answers to vote for")
+	}
+
+	winner := order[0]
+	for _, vote := range order[1:] {
+		if votes[vote] > votes[winner] {
+			winner = vote
+		}
+	}
+
+	log.Infof("Votes: %v, winner: %q", votes, winner)
+
+	return answers[winner], votes[winner], nil
+}
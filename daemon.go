@@ -0,0 +1,612 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/mattn/go-isatty"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// envDaemonSocket overrides path of the daemon socket for the daemon and its clients.
+const envDaemonSocket = envConfigPrefix + "DAEMON_SOCKET"
+
+const daemonDialTimeout = 200 * time.Millisecond
+
+// daemonAcceptTimeout limits how long a client waits for the daemon to accept a command,
+// so a stuck daemon doesn't hang the client, which runs the command itself then.
+const daemonAcceptTimeout = 5 * time.Second
+
+// Commands of daemon clients.
+const (
+	daemonCommandAsk    = "ask"
+	daemonCommandStatus = "status"
+	daemonCommandStop   = "stop"
+)
+
+// Statuses of daemon responses.
+const (
+	daemonStatusAccept   = "accept"
+	daemonStatusFallback = "fallback"
+	daemonStatusOutput   = "output"
+	daemonStatusDone     = "done"
+)
+
+// DaemonRequest is a message from a client to the daemon. The first message names the command,
+// for ask command the client sends its stdin in the second one if the daemon needs it.
+type DaemonRequest struct {
+	Command       string   `json:"command,omitempty"`
+	Args          []string `json:"args,omitempty"`
+	Fingerprint   string   `json:"fingerprint,omitempty"`
+	StdinTerminal bool     `json:"stdinterminal,omitempty"`
+	Stdin         *string  `json:"stdin,omitempty"`
+}
+
+// DaemonResponse is a message from the daemon to a client.
+type DaemonResponse struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	NeedStdin bool      `json:"needstdin,omitempty"`
+	Stdout    string    `json:"stdout,omitempty"`
+	Stderr    string    `json:"stderr,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	PID       int       `json:"pid,omitempty"`
+	Started   time.Time `json:"started,omitempty"`
+	Requests  int64     `json:"requests,omitempty"`
+}
+
+// Daemon runs ask commands of clients connected to its Unix socket. It keeps the configuration,
+// resolved API keys, loaded tokenizers and HTTP connections to AI providers between the commands.
+type Daemon struct {
+	socketPath string
+	started    time.Time
+	requests   atomic.Int64
+
+	mu           sync.RWMutex
+	config       *ProgramConfig
+	apiKeys      map[string]string
+	fingerprint  string
+	fingerprints fingerprintCache
+
+	// asking is held for reading by commands in progress, engines, tokenizers and the audit log
+	// are process-wide, so they are replaced on reload only when no command uses them
+	asking sync.RWMutex
+
+	listener net.Listener
+	active   sync.WaitGroup
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// daemonConn sends responses to a client, output of a command can be written from several goroutines.
+type daemonConn struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// daemonOutput writes output of a command to the client as stdout or stderr messages.
+type daemonOutput struct {
+	conn   *daemonConn
+	stderr bool
+}
+
+func getDaemonSocketPath() (string, error) {
+	if path := os.Getenv(envDaemonSocket); path != "" {
+		return expandHomeDir(path), nil
+	}
+
+	userProgramDir, err := getProgramUserDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userProgramDir, defaultDaemonDir, defaultDaemonSocketName), nil
+}
+
+// configFingerprint identifies the configuration a run in the working directory would load: paths of config files
+// with their sizes and modification times, the profile, ASKAI_* environment variables and hashes of the variables
+// which secrets refer to like "env:OPENAI_API_KEY", so a client with other keys doesn't use the keys of the daemon.
+func configFingerprint(profile string) (string, error) {
+	stamp, err := configFilesStamp()
+	if err != nil {
+		return "", err
+	}
+
+	return stampedConfigFingerprint(stamp, profile)
+}
+
+// configFilesStamp lists config files with their sizes and modification times, configuration of a process
+// can change only with them, as its environment stays the same.
+func configFilesStamp() (string, error) {
+	configFiles, err := getConfigFiles()
+	if err != nil {
+		return "", err
+	}
+
+	var stamp strings.Builder
+	for _, configFile := range configFiles {
+		fmt.Fprintf(&stamp, "file %s %s", configFile.scope, configFile.path)
+		if fileInfo, err := os.Stat(configFile.path); err == nil {
+			fmt.Fprintf(&stamp, " %d %d", fileInfo.Size(), fileInfo.ModTime().UnixNano())
+		}
+		fmt.Fprintln(&stamp)
+	}
+
+	return stamp.String(), nil
+}
+
+func stampedConfigFingerprint(stamp string, profile string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprint(hash, stamp)
+	fmt.Fprintf(hash, "profile %s\n", profile)
+
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, variable := range environ {
+		if strings.HasPrefix(variable, envConfigPrefix) && !strings.HasPrefix(variable, envDaemonSocket+"=") {
+			fmt.Fprintf(hash, "env %s\n", variable)
+		}
+	}
+
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return "", err
+	}
+
+	for _, variable := range secretEnvVariables(layers) {
+		value := sha256.Sum256([]byte(os.Getenv(variable)))
+		fmt.Fprintf(hash, "secret env %s %x\n", variable, value)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fingerprintCache keeps the fingerprint of the configuration of the daemon until config files change,
+// so requests don't load all config layers and hash the environment again.
+type fingerprintCache struct {
+	mutex       sync.Mutex
+	stamp       string
+	profile     string
+	fingerprint string
+}
+
+func (c *fingerprintCache) get(profile string) (string, error) {
+	stamp, err := configFilesStamp()
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.fingerprint == "" || stamp != c.stamp || profile != c.profile {
+		fingerprint, err := stampedConfigFingerprint(stamp, profile)
+		if err != nil {
+			return "", err
+		}
+
+		c.stamp, c.profile, c.fingerprint = stamp, profile, fingerprint
+	}
+
+	return c.fingerprint, nil
+}
+
+// secretEnvVariables returns names of environment variables referred to by values of the layers in alphabetical order.
+func secretEnvVariables(layers []ConfigLayer) []string {
+	variables := make(map[string]bool)
+	for _, layer := range layers {
+		for _, value := range layer.values {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+
+			if source, argument, isReference := parseSecretReference(text); isReference && source == secretSourceEnv {
+				variables[argument] = true
+			}
+		}
+	}
+
+	names := maps.Keys(variables)
+	sort.Strings(names)
+	return names
+}
+
+func newDaemon(socketPath string, config *ProgramConfig) (*Daemon, error) {
+	daemon := &Daemon{
+		socketPath: socketPath,
+		started:    time.Now(),
+		config:     config,
+		apiKeys:    resolveAvailableAPIKeys(config),
+		stopped:    make(chan struct{}),
+	}
+
+	fingerprint, err := daemon.fingerprints.get(configProfile)
+	if err != nil {
+		return nil, err
+	}
+	daemon.fingerprint = fingerprint
+
+	return daemon, nil
+}
+
+// listen creates the socket, it's accessible only by the user. A socket left by a daemon
+// which is not running anymore is replaced.
+func (d *Daemon) listen() error {
+	if conn, err := net.DialTimeout("unix", d.socketPath, daemonDialTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon is already running on %s", d.socketPath)
+	}
+
+	const dirPermissionMask = 0700
+	if err := os.MkdirAll(filepath.Dir(d.socketPath), dirPermissionMask); err != nil {
+		return fmt.Errorf("failed to create daemon directory: %w", err)
+	}
+
+	if err := os.Remove(d.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale daemon socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", d.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", d.socketPath, err)
+	}
+
+	const socketPermissionMask = 0600
+	if err = os.Chmod(d.socketPath, socketPermissionMask); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to set permissions of daemon socket: %w", err)
+	}
+
+	d.listener = listener
+	return nil
+}
+
+// serve accepts clients until the daemon is stopped, then waits for commands in progress.
+func (d *Daemon) serve() error {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			select {
+			case <-d.stopped:
+				d.active.Wait()
+				return nil
+			default:
+				return fmt.Errorf("daemon failed to accept connection: %w", err)
+			}
+		}
+
+		d.active.Add(1)
+		go func() {
+			defer d.active.Done()
+			d.handleConn(conn)
+		}()
+	}
+}
+
+func (d *Daemon) stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopped)
+		d.listener.Close()
+	})
+}
+
+func (d *Daemon) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	client := &daemonConn{encoder: json.NewEncoder(conn)}
+
+	var request DaemonRequest
+	if err := decoder.Decode(&request); err != nil {
+		log.Warningf("Daemon: failed to read request: %v", err)
+		return
+	}
+
+	switch request.Command {
+	case daemonCommandAsk:
+		d.requests.Add(1)
+		d.handleAsk(conn, decoder, client, request)
+	case daemonCommandStatus:
+		client.send(DaemonResponse{Status: daemonStatusDone, PID: os.Getpid(), Started: d.started, Requests: d.requests.Load()})
+	case daemonCommandStop:
+		log.Infof("Daemon: stop is requested")
+		client.send(DaemonResponse{Status: daemonStatusDone})
+		d.stop()
+	default:
+		client.send(DaemonResponse{Status: daemonStatusDone, Error: fmt.Sprintf("unknown daemon command: %s", request.Command)})
+	}
+}
+
+// refresh reloads the configuration if config files or their set have changed since it was loaded.
+func (d *Daemon) refresh() {
+	fingerprint, err := d.fingerprints.get(configProfile)
+	if err != nil {
+		log.Warningf("Daemon: %v", err)
+		return
+	}
+
+	d.mu.RLock()
+	changed := fingerprint != d.fingerprint
+	d.mu.RUnlock()
+
+	if !changed {
+		return
+	}
+
+	// a slow command mustn't block the others, clients with the new configuration run commands themselves meanwhile
+	if !d.asking.TryLock() {
+		log.Infof("Daemon: configuration is reloaded after commands in progress")
+		return
+	}
+	defer d.asking.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if fingerprint == d.fingerprint {
+		return
+	}
+
+	// if the new configuration is invalid, the old one is kept and clients with the new one run commands themselves
+	config, err := initProgramConfig()
+	if err != nil {
+		log.Warningf("Daemon: failed to reload configuration: %v", err)
+		return
+	}
+
+	log.Infof("Daemon: configuration is reloaded")
+
+	initEngines(*config)
+	askai.InitTokenizers(config.Tokenizer.encodingCache(), log.StandardLogger())
+	initAuditLog(config.Audit)
+
+	d.config = config
+	d.apiKeys = resolveAvailableAPIKeys(config)
+	d.fingerprint = fingerprint
+}
+
+// checkAsk parses options of ask command and returns why the command must be run by the client, if so.
+func (d *Daemon) checkAsk(request DaemonRequest) (ProgramOptions, string) {
+	var progOptions ProgramOptions
+
+	if request.Fingerprint != d.fingerprint {
+		return progOptions, "configuration differs"
+	}
+
+	// the client prints help and errors of the options itself
+	flagSet := newCommandFlagSet(askCommandName)
+	flagSet.SetOutput(io.Discard)
+	progOptions.add(flagSet, d.config.Engine)
+
+	if parsed, _ := progOptions.parse(flagSet, request.Args); !parsed || progOptions.validate() != nil {
+		return progOptions, "options are not valid"
+	}
+
+	// these options change state of the whole process
+	if progOptions.contentType != "" || progOptions.debug {
+		return progOptions, "options -ct and -debug are not supported"
+	}
+
+	// columns of comparison depend on the client's terminal
+	if progOptions.compare != "" {
+		return progOptions, "option -compare is not supported"
+	}
+
+	if !progOptions.noStdin && request.StdinTerminal && progOptions.cmdPrompt == "" && !progOptions.batchMode {
+		return progOptions, "prompt must be entered"
+	}
+
+	for _, engine := range progOptions.usedEngines() {
+		aiProvider, _, err := askai.SplitEngineName(engine)
+		if err != nil {
+			return progOptions, err.Error()
+		}
+
+		if _, exists := d.apiKeys[aiProvider]; !exists && !askai.IsTestEngine(aiProvider) {
+			return progOptions, fmt.Sprintf("API key of %s is not available", aiProvider)
+		}
+	}
+
+	return progOptions, ""
+}
+
+func (d *Daemon) handleAsk(conn net.Conn, decoder *json.Decoder, client *daemonConn, request DaemonRequest) {
+	d.refresh()
+
+	d.asking.RLock()
+	defer d.asking.RUnlock()
+
+	d.mu.RLock()
+	progOptions, reason := d.checkAsk(request)
+	config := *d.config
+	config.APIKeys = maps.Clone(d.apiKeys)
+	d.mu.RUnlock()
+
+	if reason != "" {
+		log.Infof("Daemon: command is run by the client: %s", reason)
+		client.send(DaemonResponse{Status: daemonStatusFallback, Reason: reason})
+		return
+	}
+
+	needStdin := !progOptions.noStdin && !request.StdinTerminal
+	if err := client.send(DaemonResponse{Status: daemonStatusAccept, NeedStdin: needStdin}); err != nil {
+		return
+	}
+
+	var stdinPrompt string
+	if needStdin {
+		var stdinRequest DaemonRequest
+		if err := decoder.Decode(&stdinRequest); err != nil || stdinRequest.Stdin == nil {
+			log.Warningf("Daemon: failed to read stdin of the client: %v", err)
+			return
+		}
+		stdinPrompt = strings.TrimSpace(*stdinRequest.Stdin)
+	}
+
+	// the command is canceled if the client disconnects, e.g. on Ctrl+C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		var ignored DaemonRequest
+		_ = decoder.Decode(&ignored)
+		cancel()
+	}()
+
+	log.Debugf("Daemon: program options: %v", progOptions)
+
+	err := askWithOptions(ctx, progOptions, stdinPrompt, &config,
+		&daemonOutput{conn: client}, &daemonOutput{conn: client, stderr: true})
+
+	response := DaemonResponse{Status: daemonStatusDone}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	client.send(response)
+}
+
+func (c *daemonConn) send(response DaemonResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.encoder.Encode(response)
+}
+
+func (o *daemonOutput) Write(data []byte) (int, error) {
+	response := DaemonResponse{Status: daemonStatusOutput}
+	if o.stderr {
+		response.Stderr = string(data)
+	} else {
+		response.Stdout = string(data)
+	}
+
+	if err := o.conn.send(response); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// askViaDaemon runs ask command in the daemon if it's running and can run the command like this process would.
+// It returns false if the command must be run in-process.
+func askViaDaemon(profile string, args []string) (bool, error) {
+	socketPath, err := getDaemonSocketPath()
+	if err != nil {
+		return false, nil
+	}
+
+	return askViaDaemonSocket(socketPath, profile, args, os.Stdin, isatty.IsTerminal(os.Stdin.Fd()), os.Stdout, os.Stderr)
+}
+
+func askViaDaemonSocket(socketPath string, profile string, args []string, stdin io.Reader, stdinTerminal bool,
+	stdout io.Writer, stderr io.Writer) (bool, error) {
+	conn, err := net.DialTimeout("unix", socketPath, daemonDialTimeout)
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	fingerprint, err := configFingerprint(profile)
+	if err != nil {
+		return false, nil
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(daemonAcceptTimeout)); err != nil {
+		return false, nil
+	}
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+
+	request := DaemonRequest{Command: daemonCommandAsk, Args: args, Fingerprint: fingerprint, StdinTerminal: stdinTerminal}
+	if err = encoder.Encode(request); err != nil {
+		return false, nil
+	}
+
+	// nothing is read from stdin before the daemon accepts the command, so it can still be run in-process
+	var response DaemonResponse
+	if err = decoder.Decode(&response); err != nil || response.Status != daemonStatusAccept {
+		return false, nil
+	}
+
+	// answers of engines take as long as they take, the command is stopped by Ctrl+C
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		return true, fmt.Errorf("failed to reset deadline of daemon connection: %w", err)
+	}
+
+	// the command is logged by the daemon
+	log.SetOutput(io.Discard)
+
+	if response.NeedStdin {
+		stdinPrompt, err := readStreamedPrompt(stdin)
+		if err != nil {
+			return true, err
+		}
+
+		if err = encoder.Encode(DaemonRequest{Stdin: &stdinPrompt}); err != nil {
+			return true, fmt.Errorf("failed to send stdin to daemon: %w", err)
+		}
+	}
+
+	for {
+		response = DaemonResponse{}
+		if err = decoder.Decode(&response); err != nil {
+			return true, fmt.Errorf("lost connection to daemon: %w", err)
+		}
+
+		io.WriteString(stdout, response.Stdout)
+		io.WriteString(stderr, response.Stderr)
+
+		if response.Status == daemonStatusDone {
+			if response.Error != "" {
+				return true, errors.New(response.Error)
+			}
+
+			return true, nil
+		}
+	}
+}
+
+// requestDaemon sends a command without arguments like status or stop to the daemon.
+func requestDaemon(socketPath string, command string) (DaemonResponse, error) {
+	var response DaemonResponse
+
+	conn, err := net.DialTimeout("unix", socketPath, daemonDialTimeout)
+	if err != nil {
+		return response, fmt.Errorf("daemon is not running on %s", socketPath)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(daemonAcceptTimeout)); err != nil {
+		return response, fmt.Errorf("failed to set deadline of daemon connection: %w", err)
+	}
+
+	if err = json.NewEncoder(conn).Encode(DaemonRequest{Command: command}); err != nil {
+		return response, fmt.Errorf("failed to send request to daemon: %w", err)
+	}
+
+	if err = json.NewDecoder(conn).Decode(&response); err != nil {
+		return response, fmt.Errorf("failed to read response of daemon: %w", err)
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
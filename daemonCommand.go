@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const daemonCommandName = "daemon"
+
+// DaemonOptions are options of "askai daemon" command.
+type DaemonOptions struct {
+	action     string
+	socketPath string
+}
+
+func (do *DaemonOptions) add(flagSet *flag.FlagSet, socketPath string) {
+	flagSet.StringVar(&do.socketPath, "socket", socketPath, "Path of the daemon socket, "+envDaemonSocket+" sets it for clients")
+}
+
+func (do *DaemonOptions) parse(args []string, socketPath string) (bool, error) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		do.action = args[0]
+		args = args[1:]
+	}
+
+	flagSet := newCommandFlagSet(daemonCommandName)
+	do.add(flagSet, socketPath)
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	if flagSet.NArg() > 0 {
+		return false, fmt.Errorf("daemon expects no arguments, got %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	switch do.action {
+	case "":
+		do.action = daemonCommandStatus
+	case "start", daemonCommandStatus, daemonCommandStop:
+	default:
+		return false, fmt.Errorf("unknown daemon action: %s", do.action)
+	}
+
+	do.socketPath = expandHomeDir(do.socketPath)
+	return true, nil
+}
+
+// runDaemonCommand starts the daemon in foreground, stops it or shows its status.
+func runDaemonCommand(args []string, config *ProgramConfig) error {
+	socketPath, err := getDaemonSocketPath()
+	if err != nil {
+		return err
+	}
+
+	var options DaemonOptions
+	if parsed, err := options.parse(args, socketPath); !parsed {
+		return err
+	}
+
+	switch options.action {
+	case "start":
+		return startDaemon(options.socketPath, config)
+	case daemonCommandStop:
+		if _, err = requestDaemon(options.socketPath, daemonCommandStop); err != nil {
+			return err
+		}
+
+		fmt.Println("Daemon is stopped")
+		return nil
+	default:
+		response, err := requestDaemon(options.socketPath, daemonCommandStatus)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Daemon is running on %s\n", options.socketPath)
+		fmt.Printf("PID: %d\n", response.PID)
+		fmt.Printf("Started: %s (up %s)\n", response.Started.Local().Format(time.DateTime),
+			time.Since(response.Started).Round(time.Second))
+		fmt.Printf("Requests: %d\n", response.Requests)
+		return nil
+	}
+}
+
+func startDaemon(socketPath string, config *ProgramConfig) error {
+	daemon, err := newDaemon(socketPath, config)
+	if err != nil {
+		return err
+	}
+
+	if err = daemon.listen(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+			log.Infof("Daemon: stop is requested by signal")
+			daemon.stop()
+		case <-daemon.stopped:
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Daemon is listening on %s\n", socketPath)
+	log.Infof("Daemon: listening on %s", socketPath)
+
+	return daemon.serve()
+}
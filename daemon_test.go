@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func startTestDaemon(t *testing.T) (*Daemon, string) {
+	// Unix socket paths are limited to about 100 characters, so a short temporary directory is used
+	dir, err := os.MkdirTemp("", "askai")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	savedOutput := log.StandardLogger().Out
+	t.Cleanup(func() { log.SetOutput(savedOutput) })
+
+	// refresh replaces engines with ones of the reloaded configuration
+	savedEngines, savedTokenizer := engineMap, engineTokenizer
+	t.Cleanup(func() { engineMap, engineTokenizer = savedEngines, savedTokenizer })
+
+	config := &ProgramConfig{
+		Engine:                "echo",
+		ProviderModel:         defaultProviderModel,
+		PrintAIEngineTemplate: "#%s#",
+	}
+
+	socketPath := filepath.Join(dir, "daemon", "askai.sock")
+	daemon, err := newDaemon(socketPath, config)
+	assert.NoError(t, err)
+	assert.NoError(t, daemon.listen())
+
+	served := make(chan error, 1)
+	go func() { served <- daemon.serve() }()
+
+	t.Cleanup(func() {
+		daemon.stop()
+		assert.NoError(t, <-served)
+	})
+
+	return daemon, socketPath
+}
+
+func TestDaemonAsk(t *testing.T) {
+	_, socketPath := startTestDaemon(t)
+
+	info, err := os.Stat(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	var stdout, stderr bytes.Buffer
+	handled, err := askViaDaemonSocket(socketPath, "", []string{"-pe", "Hello"}, strings.NewReader("line 1\nline 2\n"), false,
+		&stdout, &stderr)
+	assert.True(t, handled)
+	assert.NoError(t, err)
+	assert.Equal(t, "#echo:echo#\nHello\nline 1\nline 2\n", stdout.String())
+
+	// stdin of a terminal isn't read when the prompt is given
+	stdout.Reset()
+	handled, err = askViaDaemonSocket(socketPath, "", []string{"Hi"}, strings.NewReader("unused"), true, &stdout, &stderr)
+	assert.True(t, handled)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi\n", stdout.String())
+
+	// errors of the command are returned to the client
+	handled, err = askViaDaemonSocket(socketPath, "", []string{"-e", "echo>", "-p", ""}, strings.NewReader(""), false,
+		&stdout, &stderr)
+	assert.True(t, handled)
+	assert.ErrorContains(t, err, "prompt to AI is empty")
+
+	response, err := requestDaemon(socketPath, daemonCommandStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), response.PID)
+	assert.Equal(t, int64(3), response.Requests)
+}
+
+func TestDaemonFallback(t *testing.T) {
+	daemon, socketPath := startTestDaemon(t)
+	daemon.apiKeys = map[string]string{}
+
+	tests := []struct {
+		profile       string
+		args          []string
+		stdinTerminal bool
+	}{
+		{profile: "other", args: []string{"Hello"}},
+		{args: []string{"-debug", "Hello"}},
+		{args: []string{"-ct", "code", "Hello"}},
+		{args: []string{"-compare", "columns", "-e", "echo,mock", "Hello"}},
+		{args: []string{"-h"}},
+		{args: []string{"-unknown"}},
+		{args: []string{"-e", "openai", "Hello"}},
+		{args: []string{}, stdinTerminal: true},
+	}
+
+	for _, test := range tests {
+		stdin := strings.NewReader("not consumed")
+		handled, err := askViaDaemonSocket(socketPath, test.profile, test.args, stdin, test.stdinTerminal,
+			&bytes.Buffer{}, &bytes.Buffer{})
+		assert.False(t, handled, test.args)
+		assert.NoError(t, err)
+		assert.Equal(t, 12, stdin.Len(), "stdin must be left for the in-process run")
+	}
+
+	handled, _ := askViaDaemonSocket(filepath.Join(t.TempDir(), "none.sock"), "", []string{"Hello"},
+		strings.NewReader(""), false, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.False(t, handled)
+}
+
+func TestDaemonStop(t *testing.T) {
+	_, socketPath := startTestDaemon(t)
+
+	_, err := requestDaemon(socketPath, daemonCommandStop)
+	assert.NoError(t, err)
+
+	_, err = requestDaemon(socketPath, daemonCommandStatus)
+	assert.ErrorContains(t, err, "not running")
+
+	_, err = os.Stat(socketPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDaemonRefreshDuringCommand(t *testing.T) {
+	daemon, socketPath := startTestDaemon(t)
+
+	// a command in progress keeps the configuration, refresh doesn't wait for it
+	daemon.asking.RLock()
+	daemon.fingerprint = "stale"
+	daemon.refresh()
+	assert.Equal(t, "stale", daemon.fingerprint)
+
+	// clients with the new configuration run the command themselves meanwhile
+	handled, err := askViaDaemonSocket(socketPath, "", []string{"Hello"}, strings.NewReader(""), true,
+		&bytes.Buffer{}, &bytes.Buffer{})
+	assert.False(t, handled)
+	assert.NoError(t, err)
+	daemon.asking.RUnlock()
+
+	daemon.refresh()
+	assert.NotEqual(t, "stale", daemon.fingerprint)
+}
+
+func TestConfigFingerprintSecretEnv(t *testing.T) {
+	t.Setenv(envConfigPrefix+"APIKEYS_OPENAI", "env:TEST_DAEMON_OPENAI_KEY")
+	t.Setenv("TEST_DAEMON_OPENAI_KEY", "sk-first")
+
+	first, err := configFingerprint("")
+	assert.NoError(t, err)
+
+	t.Setenv("TEST_DAEMON_UNRELATED", "changed")
+	unrelated, err := configFingerprint("")
+	assert.NoError(t, err)
+	assert.Equal(t, first, unrelated)
+
+	// a client with another key in the variable runs the command itself
+	t.Setenv("TEST_DAEMON_OPENAI_KEY", "sk-second")
+	second, err := configFingerprint("")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.NotContains(t, second, "sk-second")
+}
+
+func TestFingerprintCache(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { assert.NoError(t, os.Chdir(workDir)) })
+
+	projectConfig := filepath.Join(dir, defaultProjectConfigFileName)
+	assert.NoError(t, os.WriteFile(projectConfig, []byte(`{"engine": "echo"}`), 0o600))
+
+	var cache fingerprintCache
+	first, err := cache.get("")
+	assert.NoError(t, err)
+	expected, err := configFingerprint("")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, first)
+
+	// the environment of the daemon doesn't change, so it isn't hashed again until config files change
+	t.Setenv(envConfigPrefix+"ENGINE", "mock")
+	cached, err := cache.get("")
+	assert.NoError(t, err)
+	assert.Equal(t, first, cached)
+
+	assert.NoError(t, os.WriteFile(projectConfig, []byte(`{"engine": "openai"}`), 0o600))
+	changed, err := cache.get("")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+	expected, err = configFingerprint("")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, changed)
+
+	other, err := cache.get("work")
+	assert.NoError(t, err)
+	assert.NotEqual(t, changed, other)
+}
+
+func TestSecretEnvVariables(t *testing.T) {
+	layer := newConfigLayer("test")
+	layer.values["apikeys.openai"] = "env:OPENAI_API_KEY"
+	layer.values["profiles.work.apikeys.cohere"] = "env: WORK_COHERE_KEY"
+	layer.values["serve.token"] = "keyring:serve"
+	layer.values["apikeys.cohere"] = "plain-key"
+	layer.values["logmaxsize"] = 10
+
+	assert.Equal(t, []string{"OPENAI_API_KEY", "WORK_COHERE_KEY"}, secretEnvVariables([]ConfigLayer{layer}))
+}
+
+func TestDaemonOptions(t *testing.T) {
+	var options DaemonOptions
+	parsed, err := options.parse([]string{"start", "-socket", "/tmp/a.sock"}, "/tmp/default.sock")
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, "start", options.action)
+	assert.Equal(t, "/tmp/a.sock", options.socketPath)
+
+	options = DaemonOptions{}
+	parsed, err = options.parse(nil, "/tmp/default.sock")
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, daemonCommandStatus, options.action)
+
+	_, err = options.parse([]string{"restart"}, "/tmp/default.sock")
+	assert.Error(t, err)
+}
@@ -1,17 +1,46 @@
 package main
 
+import "github.com/ilia-funtov/askai/pkg/askai"
+
 const programName = "askai"
 
+// programVersion is set at build time with -ldflags "-X main.programVersion=..."
+var programVersion = "dev"
+
 const defaultConfigDir = "config"
 const defaultLogDir = "log"
+const defaultCacheDir = "cache"
+const defaultKeysDir = "keys"
+const defaultAuditDir = "audit"
+const defaultAuditFileName = "audit.jsonl"
+const defaultTelemetryEndpoint = "http://localhost:4318"
+const defaultServeAddr = "127.0.0.1:8080"
+const defaultServeCacheTTL = 3600
+const defaultDaemonDir = "run"
+const defaultDaemonSocketName = "askai.sock"
+const defaultTiktokenCacheDir = "tiktoken"
 
 const defaultConfigFileExtension = "json"
+const defaultSystemConfigDir = "/etc/" + programName
+const defaultProjectConfigFileName = "." + programName + "." + defaultConfigFileExtension
 const defaultLogFileName = programName + ".log"
+const defaultLogPrompts = askai.LogPromptsHash
+const defaultLogMaxSize = 10 // megabytes
+const defaultLogMaxAge = 30  // days
+const defaultLogMaxBackups = 5
 const defaultPrintAIEngineTemplate = "#%s#"
 const defaultEngine = "cohere"
 const defaultSummarizePrompt = "Summarize:"
+const defaultFallbackPolicy = askai.FallbackPolicyRetryable
+const defaultTokenizerFallback = askai.TokenizerFallbackRough
+const defaultKeyStore = keyStoreAuto
+const defaultJudgePrompt = "Below are a question and answers to it given by several AI assistants. " +
+	"Combine them into a single answer which is the most correct and complete. " +
+	"Don't mention the assistants or the answers, just answer the question:"
 
 var defaultProviderModel = map[string]string{
 	"openai": "gpt-3.5-turbo",
 	"cohere": "command-xlarge-nightly",
+	"echo":   "echo",
+	"mock":   "mock",
 }
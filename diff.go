@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+type diffKind int
+
+const (
+	diffEqual diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffKind
+	text string
+}
+
+// wordDiff makes word-level diff of two texts based on the longest common subsequence of words.
+func wordDiff(a string, b string) []diffOp {
+	wordsA := strings.Fields(a)
+	wordsB := strings.Fields(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of wordsA[i:] and wordsB[j:]
+	lcs := make([][]int, len(wordsA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(wordsB)+1)
+	}
+
+	for i := len(wordsA) - 1; i >= 0; i-- {
+		for j := len(wordsB) - 1; j >= 0; j-- {
+			if wordsA[i] == wordsB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(wordsA)+len(wordsB))
+
+	i, j := 0, 0
+	for i < len(wordsA) && j < len(wordsB) {
+		switch {
+		case wordsA[i] == wordsB[j]:
+			ops = append(ops, diffOp{diffEqual, wordsA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{diffDelete, wordsA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{diffInsert, wordsB[j]})
+			j++
+		}
+	}
+
+	for ; i < len(wordsA); i++ {
+		ops = append(ops, diffOp{diffDelete, wordsA[i]})
+	}
+
+	for ; j < len(wordsB); j++ {
+		ops = append(ops, diffOp{diffInsert, wordsB[j]})
+	}
+
+	return ops
+}
+
+// formatWordDiff joins words of diff, enclosing runs of deleted and inserted words into the given markers.
+func formatWordDiff(ops []diffOp, delStart string, delEnd string, insStart string, insEnd string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(ops); {
+		kind := ops[i].kind
+
+		words := make([]string, 0)
+		for ; i < len(ops) && ops[i].kind == kind; i++ {
+			words = append(words, ops[i].text)
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+
+		run := strings.Join(words, " ")
+		switch kind {
+		case diffDelete:
+			sb.WriteString(delStart + run + delEnd)
+		case diffInsert:
+			sb.WriteString(insStart + run + insEnd)
+		default:
+			sb.WriteString(run)
+		}
+	}
+
+	return sb.String()
+}
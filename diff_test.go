@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordDiff(t *testing.T) {
+	diff := wordDiff("Hello there my friend", "Hello here my dear friend")
+	assert.Equal(t, "Hello [-there-] {+here+} my {+dear+} friend", formatWordDiff(diff, "[-", "-]", "{+", "+}"))
+
+	diff = wordDiff("", "new text")
+	assert.Equal(t, "{+new text+}", formatWordDiff(diff, "[-", "-]", "{+", "+}"))
+
+	diff = wordDiff("same", "same")
+	assert.Equal(t, "same", formatWordDiff(diff, "[-", "-]", "{+", "+}"))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/mattn/go-isatty"
+)
+
+const keysCommandName = "keys"
+
+// KeysOptions are options of "askai keys" command.
+type KeysOptions struct {
+	action     string
+	args       []string
+	keyStore   string
+	noValidate bool
+}
+
+func (ko *KeysOptions) add(flagSet *flag.FlagSet, keyStore string) {
+	flagSet.StringVar(&ko.keyStore, "store", keyStore, "Key store to save API key to with set: auto, keyring, age or config")
+	flagSet.BoolVar(&ko.noValidate, "novalidate", false, "Save API key with set without checking it with the provider")
+}
+
+func (ko *KeysOptions) parse(args []string, keyStore string) (bool, error) {
+	// the action goes first, so flags after it like "set openai -store age" are parsed
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ko.action = args[0]
+		args = args[1:]
+	}
+
+	flagSet := newCommandFlagSet(keysCommandName)
+	ko.add(flagSet, keyStore)
+
+	// a provider name may go before flags, like "set openai -store age"
+	var names []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		names = append(names, args[0])
+		args = args[1:]
+	}
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	ko.args = append(names, flagSet.Args()...)
+	if ko.action == "" {
+		ko.action = "list"
+	}
+
+	switch ko.action {
+	case "list":
+		if len(ko.args) != 0 {
+			return false, fmt.Errorf("keys list expects no arguments")
+		}
+	case "set", "remove":
+		if len(ko.args) != 1 {
+			return false, fmt.Errorf("keys %s expects a provider name", ko.action)
+		}
+
+		if ko.action == "set" && (!isValidKeyStore(ko.keyStore) || ko.keyStore == keyStoreNone) {
+			return false, fmt.Errorf("invalid key store: %s, expected %s, %s, %s or %s", ko.keyStore,
+				keyStoreAuto, keyStoreKeyring, keyStoreAge, keyStoreConfig)
+		}
+	case "test":
+	default:
+		return false, fmt.Errorf("unknown keys action: %s", ko.action)
+	}
+
+	for _, aiProvider := range ko.args {
+		if _, exists := engineMap[aiProvider]; !exists {
+			return false, fmt.Errorf("unknown AI provider: %s", aiProvider)
+		}
+	}
+
+	return true, nil
+}
+
+// runKeysCommand manages API keys of AI providers, full keys are never printed.
+func runKeysCommand(args []string, config *ProgramConfig) error {
+	var options KeysOptions
+	if parsed, err := options.parse(args, config.KeyStore); !parsed {
+		return err
+	}
+
+	configFilePath, err := getUserConfigFilePath()
+	if err != nil {
+		return err
+	}
+
+	configFile := ConfigFile{scope: configScopeUser, path: configFilePath}
+
+	switch options.action {
+	case "list":
+		return listAPIKeys(os.Stdout)
+	case "set":
+		return setAPIKey(configFile, options.args[0], options.keyStore, !options.noValidate)
+	case "remove":
+		return removeAPIKey(configFile, options.args[0])
+	case "test":
+		return testAPIKeys(os.Stdout, config.APIKeys, options.args)
+	}
+
+	return nil
+}
+
+func getKeyProviders() []string {
+	providers := make([]string, 0, len(engineMap))
+	for aiProvider := range engineMap {
+		if !askai.IsTestEngine(aiProvider) {
+			providers = append(providers, aiProvider)
+		}
+	}
+
+	sort.Strings(providers)
+	return providers
+}
+
+// listAPIKeys prints API keys of the configuration in effect with their sources, keys are masked.
+func listAPIKeys(w io.Writer) error {
+	effective, err := loadEffectiveConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tKEY\tSOURCE")
+
+	for _, aiProvider := range getKeyProviders() {
+		value, exists := effective[joinConfigKey("apikeys", aiProvider)]
+		if !exists {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", aiProvider, "missing", "")
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", aiProvider, maskSecretValue(fmt.Sprint(value.value)), value.source)
+	}
+
+	return tw.Flush()
+}
+
+// readAPIKey reads API key from the terminal without echo or, if stdin is not a terminal, from stdin,
+// so keys can be piped from password managers.
+func readAPIKey(aiProvider string) (string, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return readAPIKeyFrom(os.Stdin)
+	}
+
+	return readHiddenInput(fmt.Sprintf("Enter API key for %s: ", aiProvider))
+}
+
+func readAPIKeyFrom(reader io.Reader) (string, error) {
+	apiKey, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read API key from stdin: %w", err)
+	}
+
+	return strings.TrimSpace(apiKey), nil
+}
+
+// setAPIKey saves API key to the key store and a reference to it to the config file.
+func setAPIKey(configFile ConfigFile, aiProvider string, keyStore string, validate bool) error {
+	apiKey, err := readAPIKey(aiProvider)
+	if err != nil {
+		return err
+	}
+
+	if apiKey == "" {
+		return fmt.Errorf("API key is empty")
+	}
+
+	if validate {
+		if _, err = validateAPIKey(aiProvider, apiKey); err != nil {
+			return err
+		}
+	}
+
+	value, err := storeAPIKey(keyStore, aiProvider, apiKey)
+	if err != nil {
+		return err
+	}
+
+	err = updateConfigFile(configFile, func(layer ConfigLayer) error {
+		layer.values[joinConfigKey("apikeys", aiProvider)] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "API key for %s is saved as %s\n", aiProvider, maskSecretValue(value))
+	return nil
+}
+
+// removeAPIKey deletes API key from the key store and from the config file.
+func removeAPIKey(configFile ConfigFile, aiProvider string) error {
+	layer, err := loadConfigFileLayer(configFile.path)
+	if err != nil {
+		return err
+	}
+
+	key := joinConfigKey("apikeys", aiProvider)
+	value, exists := layer.values[key]
+	if !exists {
+		return fmt.Errorf("API key for %s is not set in %s", aiProvider, configFile.path)
+	}
+
+	if err = deleteStoredAPIKey(aiProvider, fmt.Sprint(value)); err != nil {
+		return err
+	}
+
+	return unsetConfigValue(configFile, key)
+}
+
+// testAPIKeys resolves API keys of the providers and checks them with the providers.
+// All providers with configured keys are tested if none is given.
+func testAPIKeys(w io.Writer, apiKeys map[string]string, providers []string) error {
+	if len(providers) == 0 {
+		for _, aiProvider := range getKeyProviders() {
+			if _, exists := apiKeys[aiProvider]; exists {
+				providers = append(providers, aiProvider)
+			}
+		}
+	}
+
+	if len(providers) == 0 {
+		return fmt.Errorf("no API keys are set")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tKEY\tRESULT")
+
+	failed := 0
+	for _, aiProvider := range providers {
+		maskedKey, result, passed := testAPIKey(aiProvider, apiKeys)
+		if !passed {
+			failed++
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", aiProvider, maskedKey, result)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d API keys failed the test", failed, len(providers))
+	}
+
+	return nil
+}
+
+// testAPIKey returns the masked key, the result of the test and whether the key passed it.
+func testAPIKey(aiProvider string, apiKeys map[string]string) (string, string, bool) {
+	value, exists := apiKeys[aiProvider]
+	if !exists {
+		if askai.IsTestEngine(aiProvider) {
+			return "missing", "not needed", true
+		}
+		return "missing", "not set", false
+	}
+
+	apiKey, err := resolveSecret(value, aiProvider)
+	if err != nil {
+		return maskSecretValue(value), err.Error(), false
+	}
+
+	checked, err := validateAPIKey(aiProvider, apiKey)
+	switch {
+	case err != nil:
+		return maskAPIKey(apiKey), err.Error(), false
+	case !checked:
+		return maskAPIKey(apiKey), "not checked", true
+	default:
+		return maskAPIKey(apiKey), "ok", true
+	}
+}
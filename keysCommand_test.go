@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeysOptions(t *testing.T) {
+	var options KeysOptions
+	parsed, err := options.parse([]string{"set", "openai", "-store", "age"}, keyStoreAuto)
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, "set", options.action)
+	assert.Equal(t, []string{"openai"}, options.args)
+	assert.Equal(t, keyStoreAge, options.keyStore)
+
+	options = KeysOptions{}
+	parsed, err = options.parse([]string{"set", "-novalidate", "cohere"}, keyStoreAuto)
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, []string{"cohere"}, options.args)
+	assert.True(t, options.noValidate)
+	assert.Equal(t, keyStoreAuto, options.keyStore)
+
+	options = KeysOptions{}
+	parsed, err = options.parse(nil, keyStoreNone)
+	assert.NoError(t, err)
+	assert.True(t, parsed)
+	assert.Equal(t, "list", options.action)
+
+	options = KeysOptions{}
+	_, err = options.parse([]string{"set", "openai"}, keyStoreNone)
+	assert.Error(t, err)
+
+	options = KeysOptions{}
+	_, err = options.parse([]string{"set"}, keyStoreAuto)
+	assert.Error(t, err)
+
+	options = KeysOptions{}
+	_, err = options.parse([]string{"test", "unknown"}, keyStoreAuto)
+	assert.Error(t, err)
+
+	options = KeysOptions{}
+	_, err = options.parse([]string{"rotate"}, keyStoreAuto)
+	assert.Error(t, err)
+}
+
+func TestReadAPIKeyFrom(t *testing.T) {
+	apiKey, err := readAPIKeyFrom(strings.NewReader("sk-1234567890\nrest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-1234567890", apiKey)
+
+	apiKey, err = readAPIKeyFrom(strings.NewReader("  sk-1234567890  "))
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-1234567890", apiKey)
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	checked, err := validateAPIKey("echo", "key")
+	assert.NoError(t, err)
+	assert.False(t, checked)
+
+	savedMock := engineMap["mock"]
+	defer func() { engineMap["mock"] = savedMock }()
+
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{})
+	checked, err = validateAPIKey("mock", "key")
+	assert.NoError(t, err)
+	assert.True(t, checked)
+
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{ErrorRate: 1})
+	checked, err = validateAPIKey("mock", "key")
+	assert.Error(t, err)
+	assert.True(t, checked)
+
+	_, err = validateAPIKey("unknown", "key")
+	assert.Error(t, err)
+}
+
+func TestTestAPIKeys(t *testing.T) {
+	t.Setenv("ASKAI_TEST_SECRET", "mock-key-1234567890")
+
+	savedMock := engineMap["mock"]
+	defer func() { engineMap["mock"] = savedMock }()
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{})
+
+	apiKeys := map[string]string{"mock": "env:ASKAI_TEST_SECRET", "echo": "echo-key-1234567890"}
+
+	var output bytes.Buffer
+	err := testAPIKeys(&output, apiKeys, []string{"mock", "echo"})
+	assert.NoError(t, err)
+	assert.Contains(t, output.String(), "****7890")
+	assert.NotContains(t, output.String(), "mock-key-1234567890")
+	assert.Contains(t, output.String(), "not checked")
+
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{ErrorRate: 1})
+	output.Reset()
+	err = testAPIKeys(&output, apiKeys, []string{"mock", "echo"})
+	assert.Error(t, err)
+
+	output.Reset()
+	err = testAPIKeys(&output, map[string]string{"mock": "env:ASKAI_TEST_SECRET_NOT_SET"}, []string{"mock"})
+	assert.Error(t, err)
+	assert.Contains(t, output.String(), "env:ASKAI_TEST_SECRET_NOT_SET")
+}
+
+func TestDeleteStoredAPIKey(t *testing.T) {
+	// files which weren't saved by the program are kept
+	path := filepath.Join(t.TempDir(), "openai.age")
+	assert.NoError(t, os.WriteFile(path, []byte("secret"), 0600))
+
+	assert.NoError(t, deleteStoredAPIKey("openai", "age:"+path))
+	assert.FileExists(t, path)
+
+	assert.NoError(t, deleteStoredAPIKey("openai", "env:OPENAI_API_KEY"))
+	assert.NoError(t, deleteStoredAPIKey("openai", "sk-1234567890"))
+}
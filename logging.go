@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logPromptMode defines how prompts and responses are written to the log, it's passed to AI clients.
+var logPromptMode = defaultLogPrompts
+
+// minLogSecretLen keeps short values from being masked everywhere in the log.
+const minLogSecretLen = 8
+
+// logSecrets are values which are always masked in the log, like API keys.
+var logSecrets struct {
+	sync.RWMutex
+	values map[string]bool
+}
+
+// addLogSecret makes the value masked wherever it appears in the log.
+func addLogSecret(secret string) {
+	if len(secret) < minLogSecretLen {
+		return
+	}
+
+	logSecrets.Lock()
+	defer logSecrets.Unlock()
+
+	if logSecrets.values == nil {
+		logSecrets.values = make(map[string]bool)
+	}
+	logSecrets.values[secret] = true
+}
+
+func maskLogSecrets(data []byte) []byte {
+	logSecrets.RLock()
+	defer logSecrets.RUnlock()
+
+	for secret := range logSecrets.values {
+		data = bytes.ReplaceAll(data, []byte(secret), []byte(maskAPIKey(secret)))
+	}
+
+	return data
+}
+
+// maskingFormatter masks secrets in log entries formatted by the wrapped formatter.
+type maskingFormatter struct {
+	formatter log.Formatter
+}
+
+func (f *maskingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	data, err := f.formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return maskLogSecrets(data), nil
+}
+
+// newLogFileWriter returns writer to the log file which is rotated by size and age according to config.
+func newLogFileWriter(logFilePath string, config ProgramConfig) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   filepath.Clean(logFilePath),
+		MaxSize:    config.LogMaxSize,
+		MaxAge:     config.LogMaxAge,
+		MaxBackups: config.LogMaxBackups,
+	}
+}
+
+// enableDebugLogging logs prompts and responses in full and raises the log level to debug.
+func enableDebugLogging() {
+	logPromptMode = askai.LogPromptsFull
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		log.SetLevel(log.DebugLevel)
+	}
+}
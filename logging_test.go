@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskingFormatter(t *testing.T) {
+	addLogSecret("sk-test-1234567890abcd")
+	addLogSecret("short")
+
+	formatter := &maskingFormatter{formatter: &log.TextFormatter{DisableTimestamp: true}}
+	entry := log.NewEntry(log.StandardLogger())
+	entry.Message = "request with sk-test-1234567890abcd failed, short"
+
+	data, err := formatter.Format(entry)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "sk-test-1234567890abcd")
+	assert.Contains(t, string(data), "****abcd")
+	assert.Contains(t, string(data), "short")
+}
+
+func TestProgramOptionsString(t *testing.T) {
+	savedMode := logPromptMode
+	defer func() { logPromptMode = savedMode }()
+	logPromptMode = askai.LogPromptsHash
+
+	options := ProgramOptions{cmdPrompt: "my password is hunter2", engines: []string{"echo"}}
+
+	logged := options.String()
+	assert.NotContains(t, logged, "hunter2")
+	assert.Contains(t, logged, "engines:[echo]")
+}
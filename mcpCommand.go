@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+)
+
+const mcpCommandName = "mcp"
+
+const mcpJSONRPCVersion = "2.0"
+
+// mcpProtocolVersions are versions of Model Context Protocol the server supports, the last one is preferred.
+var mcpProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// JSON-RPC error codes.
+const (
+	mcpErrorParse          = -32700
+	mcpErrorInvalidRequest = -32600
+	mcpErrorMethodNotFound = -32601
+	mcpErrorInvalidParams  = -32602
+)
+
+// Tools of the server.
+const (
+	mcpToolAsk         = "ask"
+	mcpToolCompare     = "compare"
+	mcpToolSummarize   = "summarize"
+	mcpToolCountTokens = "count_tokens"
+)
+
+const mcpDefaultSummaryTokens = 500
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpToolCall struct {
+	Name      string           `json:"name"`
+	Arguments mcpToolArguments `json:"arguments"`
+}
+
+// mcpToolArguments are arguments of all tools, each tool uses some of them.
+type mcpToolArguments struct {
+	Prompt    string   `json:"prompt"`
+	Context   string   `json:"context"`
+	Engine    string   `json:"engine"`
+	Engines   []string `json:"engines"`
+	Text      string   `json:"text"`
+	MaxTokens int      `json:"max_tokens"`
+}
+
+// MCPServer serves askai's engines as tools of Model Context Protocol over JSON-RPC messages, one per line.
+type MCPServer struct {
+	config ProgramConfig
+
+	writeMutex sync.Mutex
+	writer     io.Writer
+
+	callsMutex sync.Mutex
+	calls      map[string]context.CancelFunc
+	active     sync.WaitGroup
+}
+
+// runMCPCommand serves MCP over stdin and stdout until stdin is closed.
+func runMCPCommand(args []string, config *ProgramConfig) error {
+	flagSet := newCommandFlagSet(mcpCommandName)
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return err
+	}
+
+	if flagSet.NArg() > 0 {
+		return fmt.Errorf("mcp expects no arguments, got %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	// stdout carries the protocol, so the log must not go there and keys can't be asked
+	config.APIKeys = resolveAvailableAPIKeys(config)
+
+	log.Infof("Serving MCP over stdio")
+	return newMCPServer(*config, os.Stdout).serve(context.Background(), os.Stdin)
+}
+
+// newMCPServer returns the server of a client connection, requests of the connection are in one audit session.
+func newMCPServer(config ProgramConfig, writer io.Writer) *MCPServer {
+	config.auditSession = newAuditSession()
+	return &MCPServer{config: config, writer: writer, calls: make(map[string]context.CancelFunc)}
+}
+
+// serve handles messages until the reader is exhausted, tool calls are run concurrently and can be cancelled.
+func (s *MCPServer) serve(ctx context.Context, reader io.Reader) error {
+	defer s.active.Wait()
+
+	// messages can be long when they carry texts to summarize, so lines aren't limited like with bufio.Scanner
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read MCP message: %w", err)
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			s.handleMessage(ctx, line)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (s *MCPServer) handleMessage(ctx context.Context, line []byte) {
+	line = bytes.TrimSpace(line)
+	if line[0] == '[' {
+		s.writeError(json.RawMessage("null"), mcpErrorInvalidRequest, "batch requests are not supported")
+		return
+	}
+
+	var request mcpRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		s.writeError(json.RawMessage("null"), mcpErrorParse, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+
+	if request.JSONRPC != mcpJSONRPCVersion || request.Method == "" {
+		if len(request.ID) > 0 {
+			s.writeError(request.ID, mcpErrorInvalidRequest, "invalid JSON-RPC request")
+		}
+		return
+	}
+
+	// notifications have no id and get no response
+	if len(request.ID) == 0 {
+		s.handleNotification(request)
+		return
+	}
+
+	switch request.Method {
+	case "initialize":
+		s.writeResult(request.ID, s.initialize(request.Params))
+	case "ping":
+		s.writeResult(request.ID, struct{}{})
+	case "tools/list":
+		s.writeResult(request.ID, map[string]interface{}{"tools": mcpTools()})
+	case "tools/call":
+		var call mcpToolCall
+		if err := json.Unmarshal(request.Params, &call); err != nil {
+			s.writeError(request.ID, mcpErrorInvalidParams, fmt.Sprintf("invalid tool call: %v", err))
+			return
+		}
+
+		if !isMCPTool(call.Name) {
+			s.writeError(request.ID, mcpErrorInvalidParams, fmt.Sprintf("unknown tool: %s", call.Name))
+			return
+		}
+
+		s.startToolCall(ctx, request.ID, call)
+	default:
+		s.writeError(request.ID, mcpErrorMethodNotFound, fmt.Sprintf("method not found: %s", request.Method))
+	}
+}
+
+func (s *MCPServer) handleNotification(request mcpRequest) {
+	if request.Method != "notifications/cancelled" {
+		return
+	}
+
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return
+	}
+
+	s.callsMutex.Lock()
+	defer s.callsMutex.Unlock()
+
+	if cancel, exists := s.calls[string(params.RequestID)]; exists {
+		log.Infof("MCP: request %s is cancelled", params.RequestID)
+		cancel()
+	}
+}
+
+// initialize agrees on the protocol version, the one of the client is used if it's supported.
+func (s *MCPServer) initialize(params json.RawMessage) interface{} {
+	var request struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(params, &request)
+
+	version := mcpProtocolVersions[len(mcpProtocolVersions)-1]
+	for _, supported := range mcpProtocolVersions {
+		if request.ProtocolVersion == supported {
+			version = supported
+		}
+	}
+
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+		"serverInfo":      map[string]string{"name": programName, "version": programVersion},
+	}
+}
+
+func (s *MCPServer) startToolCall(ctx context.Context, id json.RawMessage, call mcpToolCall) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.callsMutex.Lock()
+	s.calls[string(id)] = cancel
+	s.callsMutex.Unlock()
+
+	s.active.Add(1)
+	go func() {
+		defer s.active.Done()
+		defer func() {
+			s.callsMutex.Lock()
+			delete(s.calls, string(id))
+			s.callsMutex.Unlock()
+			cancel()
+		}()
+
+		// failures of tools are results, so the model calling the tool can see them
+		text, err := s.callTool(ctx, call)
+		if err != nil {
+			log.Errorf("MCP: tool %s failed: %v", call.Name, err)
+			s.writeResult(id, mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true})
+			return
+		}
+
+		s.writeResult(id, mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}})
+	}()
+}
+
+func (s *MCPServer) callTool(ctx context.Context, call mcpToolCall) (string, error) {
+	args := call.Arguments
+
+	switch call.Name {
+	case mcpToolAsk:
+		return s.ask(ctx, args)
+	case mcpToolCompare:
+		return s.compare(ctx, args)
+	case mcpToolSummarize:
+		return s.summarize(ctx, args)
+	default:
+		return s.countTokens(args)
+	}
+}
+
+func (s *MCPServer) ask(ctx context.Context, args mcpToolArguments) (string, error) {
+	if args.Prompt == "" {
+		return "", errors.New("prompt is required")
+	}
+
+	engine := strings.ToLower(strings.TrimSpace(args.Engine))
+	if engine == "" {
+		engine = s.config.Engine
+	}
+
+	redactor, err := newRedactor(s.config.Redaction, false)
+	if err != nil {
+		return "", err
+	}
+
+	message := redactor.redactMessage(askai.UserMessage{Prompt: args.Prompt, Context: args.Context})
+	responseMap, err := newAIClient(s.config).Ask(ctx, []string{engine}, message)
+	if err != nil {
+		return "", err
+	}
+
+	var answers []string
+	for _, responses := range redactor.restoreResponseMap(responseMap) {
+		for _, response := range responses {
+			answers = append(answers, strings.TrimSpace(response))
+		}
+	}
+
+	return strings.Join(answers, "\n\n"), nil
+}
+
+func (s *MCPServer) compare(ctx context.Context, args mcpToolArguments) (string, error) {
+	if args.Prompt == "" {
+		return "", errors.New("prompt is required")
+	}
+
+	if len(args.Engines) < 2 {
+		return "", errors.New("at least two engines are required")
+	}
+
+	engines := make([]string, 0, len(args.Engines))
+	for _, engine := range args.Engines {
+		engines = append(engines, strings.ToLower(strings.TrimSpace(engine)))
+	}
+
+	redactor, err := newRedactor(s.config.Redaction, false)
+	if err != nil {
+		return "", err
+	}
+
+	message := redactor.redactMessage(askai.UserMessage{Prompt: args.Prompt, Context: args.Context})
+	allStats := compareEngines(ctx, engines, message, s.config)
+	for i := range allStats {
+		allStats[i].responses = redactor.restoreResponses(allStats[i].responses)
+	}
+
+	var output bytes.Buffer
+	if err = printComparison(&output, allStats, compareFormatMarkdown, ""); err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+func (s *MCPServer) summarize(ctx context.Context, args mcpToolArguments) (string, error) {
+	if args.Text == "" {
+		return "", errors.New("text is required")
+	}
+
+	maxTokens := args.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = mcpDefaultSummaryTokens
+	}
+
+	_, _, engineName, err := s.findEngine(args.Engine, true)
+	if err != nil {
+		return "", err
+	}
+
+	redactor, err := newRedactor(s.config.Redaction, false)
+	if err != nil {
+		return "", err
+	}
+
+	summary, err := newAIClient(s.config).ShortenText(ctx, engineName, redactor.redact(args.Text), maxTokens)
+	if err != nil {
+		return "", err
+	}
+
+	return redactor.restoreResponses([]string{summary})[0], nil
+}
+
+func (s *MCPServer) countTokens(args mcpToolArguments) (string, error) {
+	engine, aiModel, _, err := s.findEngine(args.Engine, false)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, err := engine.CalcTokenNum(aiModel, args.Text)
+	if err != nil {
+		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	result, err := json.Marshal(map[string]interface{}{
+		"tokens": tokens,
+		"limit":  engine.GetMaxTokenLimit(aiModel),
+	})
+	return string(result), err
+}
+
+// findEngine finds a single engine like "openai" or "openai:gpt-4", the first engine of the configuration by default.
+// The engine is returned with its model and name.
+func (s *MCPServer) findEngine(name string, needAPIKey bool) (askai.AIEngine, string, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		if engines := askai.SplitEngineChain(s.config.Engine); len(engines) > 0 {
+			name = engines[0]
+		}
+	}
+
+	aiProvider, aiModel, err := askai.SplitEngineName(name)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	engine, exists := engineMap[aiProvider]
+	if !exists {
+		return nil, "", "", fmt.Errorf("no engine found for %s", aiProvider)
+	}
+
+	if aiModel == "" {
+		aiModel = s.config.ProviderModel[aiProvider]
+	}
+
+	if _, exists := s.config.APIKeys[aiProvider]; needAPIKey && !exists && !askai.IsTestEngine(aiProvider) {
+		return nil, "", "", fmt.Errorf("no API key found for %s, set it with '%s %s set %s'",
+			aiProvider, programName, keysCommandName, aiProvider)
+	}
+
+	return engine, aiModel, name, nil
+}
+
+func (s *MCPServer) writeResult(id json.RawMessage, result interface{}) {
+	s.write(mcpResponse{JSONRPC: mcpJSONRPCVersion, ID: id, Result: result})
+}
+
+func (s *MCPServer) writeError(id json.RawMessage, code int, message string) {
+	log.Warningf("MCP: request failed: %s", message)
+	s.write(mcpResponse{JSONRPC: mcpJSONRPCVersion, ID: id, Error: &mcpError{Code: code, Message: message}})
+}
+
+func (s *MCPServer) write(response mcpResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("MCP: failed to serialize response: %v", err)
+		return
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	if _, err = s.writer.Write(append(data, '\n')); err != nil {
+		log.Errorf("MCP: failed to write response: %v", err)
+	}
+}
+
+func isMCPTool(name string) bool {
+	for _, tool := range mcpTools() {
+		if tool.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mcpTools() []mcpTool {
+	text := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": description}
+	}
+
+	schema := func(properties map[string]interface{}, required ...string) map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+
+	engine := text("AI engine like openai, cohere or openai:gpt-4, the configured one by default")
+
+	return []mcpTool{
+		{
+			Name:        mcpToolAsk,
+			Description: "Ask an AI engine with the user's configured providers and keys. Long input is summarized to fit the model.",
+			InputSchema: schema(map[string]interface{}{
+				"prompt":  text("Question or instruction"),
+				"context": text("Text the prompt is about, like a document or code"),
+				"engine":  text("AI engine like openai, cohere or openai:gpt-4, or fallback chain like openai>cohere, the configured one by default"),
+			}, "prompt"),
+		},
+		{
+			Name:        mcpToolCompare,
+			Description: "Ask several AI engines at once and compare their answers, latency and token usage in a Markdown table.",
+			InputSchema: schema(map[string]interface{}{
+				"prompt":  text("Question or instruction"),
+				"context": text("Text the prompt is about, like a document or code"),
+				"engines": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "AI engines to compare, like [\"openai\", \"cohere\"]",
+				},
+			}, "prompt", "engines"),
+		},
+		{
+			Name:        mcpToolSummarize,
+			Description: "Summarize long text to fit into the given number of tokens, parts of the text are summarized recursively.",
+			InputSchema: schema(map[string]interface{}{
+				"text":       text("Text to summarize"),
+				"max_tokens": map[string]interface{}{"type": "integer", "description": "Maximum length of the summary in tokens, 500 by default"},
+				"engine":     engine,
+			}, "text"),
+		},
+		{
+			Name:        mcpToolCountTokens,
+			Description: "Count tokens of text for an AI engine and return them with the token limit of its model as JSON.",
+			InputSchema: schema(map[string]interface{}{
+				"text":   text("Text to count tokens of"),
+				"engine": engine,
+			}, "text"),
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"golang.org/x/exp/maps"
+)
+
+const modelsCommandName = "models"
+
+// runModelsCommand lists AI providers with their configured models, token limits and tokenizers.
+func runModelsCommand(args []string, config *ProgramConfig) error {
+	flagSet := newCommandFlagSet(modelsCommandName)
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return err
+	}
+
+	providers := maps.Keys(engineMap)
+	sort.Strings(providers)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tMODEL\tLIMIT\tENCODING\tAPI KEY")
+
+	for _, aiProvider := range providers {
+		engine := engineMap[aiProvider]
+		aiModel := config.ProviderModel[aiProvider]
+
+		encoding, err := engine.GetTokenizationEncoding(aiModel)
+		switch {
+		case err != nil:
+			encoding = "unknown"
+		case encoding == "":
+			encoding = "rough"
+		}
+
+		apiKey := "missing"
+		if askai.IsTestEngine(aiProvider) {
+			apiKey = "not needed"
+		} else if _, exists := config.APIKeys[aiProvider]; exists {
+			apiKey = "set"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", aiProvider, aiModel, engine.GetMaxTokenLimit(aiModel), encoding, apiKey)
+	}
+
+	return tw.Flush()
+}
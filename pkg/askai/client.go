@@ -0,0 +1,392 @@
+package askai
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kinds of requests to engines.
+const (
+	CallKindAsk       = "ask"
+	CallKindSummarize = "summarize"
+)
+
+const (
+	errorMessageCalcTokenNum = "AIEngine.CalcTokenNum failed: %w"
+)
+
+// Options configure a Client.
+type Options struct {
+	// Engines are AI engines by provider names, built-in engines of NewEngines(Tokenizer, Logger) are used if it's nil.
+	Engines map[string]AIEngine
+	// Tokenizer configures tokenizers of built-in engines used if Engines is nil.
+	Tokenizer TokenizerConfig
+	// ProviderModel is the model used for a provider when engine name has no model, like "openai".
+	ProviderModel map[string]string
+	// APIKeys are API keys by provider names, test engines need none.
+	APIKeys map[string]string
+	// SummarizePrompt is sent with parts of too long input to shorten them.
+	SummarizePrompt string
+	// FallbackPolicy defines when the next engine of a chain is tried, FallbackPolicyRetryable by default.
+	FallbackPolicy string
+	// Observer is notified about every request sent to engines, if it's set.
+	Observer CallObserver
+	// Logger gets the log of the client, the standard logger of logrus is used if it's nil.
+	Logger log.Ext1FieldLogger
+	// LogPrompts defines how prompts and responses are written to the log, see LogText.
+	LogPrompts string
+}
+
+// Client asks AI engines: it fans a message out to several engines, falls back along engine chains
+// and shortens input which doesn't fit into the token limit of an engine. It's safe for concurrent use.
+type Client struct {
+	options Options
+}
+
+// EngineCallResult is the result of asking an engine or an engine chain.
+type EngineCallResult struct {
+	EngineKey string
+	Responses []string
+	Err       error
+}
+
+// EngineCall is a request to an AI engine with its result, it's passed to CallObserver.
+// ID numbers requests of the process, so records of BeforeCall and AfterCall can be matched.
+type EngineCall struct {
+	ID             uint64
+	Kind           string
+	Provider       string
+	Model          string
+	Message        UserMessage
+	Responses      []string
+	Err            error
+	Start          time.Time
+	Duration       time.Duration
+	PromptTokens   int
+	ResponseTokens int
+}
+
+// CallObserver is notified about requests sent to engines, e.g. to audit them or to collect metrics.
+type CallObserver interface {
+	// BeforeCall is called before the request is sent, it's not sent if an error is returned.
+	BeforeCall(ctx context.Context, call *EngineCall) error
+	// AfterCall is called with the result of the request and its numbers of tokens.
+	AfterCall(ctx context.Context, call *EngineCall)
+}
+
+// engineCallID is the ID of the last request to an engine.
+var engineCallID atomic.Uint64
+
+// boundEngine is an engine with the provider, model and API key it's called with.
+type boundEngine struct {
+	engine   AIEngine
+	provider string
+	model    string
+	apiKey   string
+}
+
+// NewClient returns a client which asks engines of the options, unset options get their defaults.
+func NewClient(options Options) *Client {
+	options.Logger = orStandardLogger(options.Logger)
+
+	if options.Engines == nil {
+		options.Engines = NewEngines(options.Tokenizer, options.Logger)
+	}
+
+	return &Client{options: options}
+}
+
+func (call EngineCall) EngineKey() string {
+	return fmt.Sprintf("%s:%s", call.Provider, call.Model)
+}
+
+// countTokens counts tokens of the prompt and the responses, errors of counting leave the numbers zero.
+func (call *EngineCall) countTokens(engine AIEngine) {
+	if tokens, err := engine.CalcTokenNum(call.Model, call.Message.GetFullPrompt()); err == nil {
+		call.PromptTokens = tokens
+	}
+
+	for _, response := range call.Responses {
+		if tokens, err := engine.CalcTokenNum(call.Model, response); err == nil {
+			call.ResponseTokens += tokens
+		}
+	}
+}
+
+// Ask asks engines or engine chains like "openai:gpt-4" or "openai>cohere" simultaneously
+// and returns their responses by engine keys like "openai:gpt-4".
+// An error is returned only if a single engine is asked, otherwise failed engines have no responses.
+func (c *Client) Ask(ctx context.Context, engines []string, message UserMessage) (map[string][]string, error) {
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no AI engine found")
+	}
+
+	ctx, span := tracer.Start(ctx, "askAI", trace.WithAttributes(attribute.StringSlice("askai.engines", engines)))
+	defer span.End()
+
+	result := make(map[string][]string)
+
+	if len(engines) == 1 {
+		callResult := c.AskChain(ctx, engines[0], message)
+		if callResult.Err != nil {
+			return nil, callResult.Err
+		}
+
+		result[callResult.EngineKey] = callResult.Responses
+		return result, nil
+	}
+
+	resultChannel := make(chan EngineCallResult)
+	processEngineAsync := func(engine string) {
+		resultChannel <- c.AskChain(ctx, engine, message)
+	}
+
+	for _, engine := range engines {
+		go processEngineAsync(engine)
+	}
+
+	for i := 0; i != len(engines); i++ {
+		callResult, ok := <-resultChannel
+		if ok {
+			result[callResult.EngineKey] = callResult.Responses
+		}
+	}
+
+	return result, nil
+}
+
+// findEngine finds the engine with its model and API key by provider and model, which is optional.
+func (c *Client) findEngine(aiProvider string, aiModel string) (boundEngine, error) {
+	if aiModel == "" {
+		var exists bool
+		aiModel, exists = c.options.ProviderModel[aiProvider]
+		if !exists {
+			return boundEngine{}, fmt.Errorf("no provider model found for %s", aiProvider)
+		}
+	}
+
+	engine, exists := c.options.Engines[aiProvider]
+	if !exists {
+		return boundEngine{}, fmt.Errorf("no engine found for %s", aiProvider)
+	}
+
+	apiKey, exists := c.options.APIKeys[aiProvider]
+	if !exists && !IsTestEngine(aiProvider) {
+		return boundEngine{}, fmt.Errorf("no API key found for %s", aiProvider)
+	}
+
+	return boundEngine{engine: engine, provider: aiProvider, model: aiModel, apiKey: apiKey}, nil
+}
+
+func (c *Client) callEngine(ctx context.Context, aiProvider string, aiModel string, message UserMessage) (result EngineCallResult) {
+	ctx, span := tracer.Start(ctx, "callAIEngine", trace.WithAttributes(attribute.String("askai.provider", aiProvider)))
+	defer func() { endSpan(span, result.Err) }()
+
+	target, err := c.findEngine(aiProvider, aiModel)
+	if err != nil {
+		return EngineCallResult{"", nil, err}
+	}
+
+	engineKey := fmt.Sprintf("%s:%s", target.provider, target.model)
+	span.SetAttributes(attribute.String("askai.model", target.model))
+
+	prompt := message.GetFullPrompt()
+	c.options.Logger.Infof("Asking %s: %s", engineKey, LogText(c.options.LogPrompts, prompt))
+
+	tokensInFullPrompt, err := target.engine.CalcTokenNum(target.model, prompt)
+	if err != nil {
+		return EngineCallResult{engineKey, nil, err}
+	}
+
+	tokenLimit := target.engine.GetMaxTokenLimit(target.model)
+
+	if tokensInFullPrompt > tokenLimit {
+		c.options.Logger.Infof("Full prompt is too long, shortening it to %d tokens at max", tokenLimit)
+
+		pMessage, err := c.shortenMessage(ctx, message, tokenLimit, target)
+		if err != nil {
+			return EngineCallResult{engineKey, nil, err}
+		}
+
+		message = *pMessage
+	}
+
+	responses, err := c.askEngine(ctx, CallKindAsk, target, message)
+	if err == nil {
+		c.options.Logger.Tracef("Engine %s returned response: %v", engineKey, LogTexts(c.options.LogPrompts, responses))
+	} else {
+		c.options.Logger.Errorf("Engine %s returned error: %v", engineKey, err)
+	}
+
+	return EngineCallResult{engineKey, responses, err}
+}
+
+// ShortenText summarizes the text with the engine, like "openai:gpt-4", until it fits into maxTokens tokens.
+// The text is returned as is if it fits already.
+func (c *Client) ShortenText(ctx context.Context, engineName string, text string, maxTokens int) (string, error) {
+	aiProvider, aiModel, err := SplitEngineName(engineName)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := c.findEngine(aiProvider, aiModel)
+	if err != nil {
+		return "", err
+	}
+
+	return c.shortenText(ctx, text, maxTokens, target)
+}
+
+func (c *Client) shortenMessage(ctx context.Context, message UserMessage, tokenLimit int, target boundEngine) (*UserMessage, error) {
+	ctx, span := tracer.Start(ctx, "shortenMessage", trace.WithAttributes(attribute.Int("askai.token_limit", tokenLimit)))
+	defer span.End()
+
+	tokensInPrompt, err := target.engine.CalcTokenNum(target.model, message.Prompt)
+	if err != nil {
+		return nil, fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	tokensInContext, err := target.engine.CalcTokenNum(target.model, message.Context)
+	if err != nil {
+		return nil, fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	shortenedPrompt, err := c.shortenText(ctx, message.Prompt, tokenLimit-tokensInContext-1, target)
+	if err != nil {
+		return nil, err
+	}
+
+	shortenedContext, err := c.shortenText(ctx, message.Context, tokenLimit-tokensInPrompt-1, target)
+	if err != nil {
+		return nil, err
+	}
+
+	message = UserMessage{Prompt: shortenedPrompt, Context: shortenedContext}
+	return &message, nil
+}
+
+func (c *Client) shortenText(ctx context.Context, text string, maxTokens int, target boundEngine) (string, error) {
+	if text == "" || maxTokens <= 0 {
+		return "", nil
+	}
+
+	engine, aiModel := target.engine, target.model
+
+	tokensNum, err := engine.CalcTokenNum(aiModel, text)
+	if err != nil {
+		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	if tokensNum <= maxTokens {
+		return text, nil
+	}
+
+	ctx, span := startShortenSpan(ctx, "shortenText", tokensNum, maxTokens)
+	defer span.End()
+
+	c.options.Logger.Tracef("Shortening text: %s", LogText(c.options.LogPrompts, text))
+
+	tldrLen, err := engine.CalcTokenNum(aiModel, c.options.SummarizePrompt)
+	if err != nil {
+		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	// a sentence of a block can be up to twice as long as the block, so blocks are at most a half of maxTokens
+	numBlocks := int(math.Ceil(float64(tokensNum) / float64(maxTokens)))
+	blockTokensNum := tokensNum / numBlocks
+	if blockTokensNum > maxTokens/oversizeSegmentFactor {
+		blockTokensNum = maxTokens / oversizeSegmentFactor
+	}
+	blockTokensNum -= tldrLen + 1
+	parts, err := engine.SplitText(aiModel, text, blockTokensNum)
+	if err != nil {
+		return "", fmt.Errorf("AIEngine.SplitText failed: %w", err)
+	}
+
+	shortenedText, err := c.shortenTextParts(ctx, parts, target)
+	if err != nil {
+		return "", err
+	}
+
+	if shortenedText == "" {
+		return "", fmt.Errorf("text content was completely lost as a result of shortening")
+	}
+
+	shortLen, err := engine.CalcTokenNum(aiModel, shortenedText)
+	if err != nil {
+		return "", fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	if shortLen >= tokensNum {
+		return "", fmt.Errorf("text was not shortened by summarization (%d tokens -> %d tokens)", tokensNum, shortLen)
+	}
+
+	if shortLen > maxTokens {
+		return c.shortenText(ctx, shortenedText, maxTokens, target)
+	}
+
+	c.options.Logger.Tracef("Shortened text: %s", LogText(c.options.LogPrompts, shortenedText))
+
+	return shortenedText, nil
+}
+
+func (c *Client) shortenTextParts(ctx context.Context, parts []string, target boundEngine) (string, error) {
+	shortenedText := ""
+
+	for _, part := range parts {
+		c.options.Logger.Tracef("Asking to shorten part: %s", LogText(c.options.LogPrompts, part))
+
+		message := UserMessage{Prompt: c.options.SummarizePrompt, Context: part}
+		responses, err := c.askEngine(ctx, CallKindSummarize, target, message)
+		if err != nil {
+			c.options.Logger.Errorf("Engine %s returned error: %v", target.provider, err)
+
+			return "", fmt.Errorf("could not shorten text: %w", err)
+		}
+
+		for _, response := range responses {
+			if len(response) > 0 {
+				if len(shortenedText) > 0 {
+					shortenedText += " "
+				}
+				shortenedText += response
+			}
+		}
+	}
+
+	return strings.TrimSpace(shortenedText), nil
+}
+
+// askEngine sends the message to the engine and notifies the observer about the call.
+// Nothing is sent if the observer rejects the call.
+func (c *Client) askEngine(ctx context.Context, kind string, target boundEngine, message UserMessage) ([]string, error) {
+	call := EngineCall{ID: engineCallID.Add(1), Kind: kind, Provider: target.provider, Model: target.model, Message: message}
+
+	if c.options.Observer != nil {
+		if err := c.options.Observer.BeforeCall(ctx, &call); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, span := startProviderCallSpan(ctx, call)
+	defer span.End()
+
+	call.Start = time.Now()
+	call.Responses, call.Err = target.engine.AskAI(ctx, message, target.model, target.apiKey)
+	call.Duration = time.Since(call.Start)
+
+	if c.options.Observer != nil {
+		call.countTokens(target.engine)
+		c.options.Observer.AfterCall(ctx, &call)
+	}
+
+	return call.Responses, call.Err
+}
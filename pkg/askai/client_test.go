@@ -0,0 +1,209 @@
+package askai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cohere "github.com/cohere-ai/cohere-go"
+	gogpt "github.com/sashabaranov/go-gpt3"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testProviderModel = map[string]string{"echo": "echo", "mock": "mock"}
+
+func writeMockResponses(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "responses.json")
+	err := os.WriteFile(path, []byte(data), 0600)
+	assert.NoError(t, err)
+	return path
+}
+
+// testClient returns a client of the built-in engines with the given mock engine.
+func testClient(mock *MockEngine, options Options) *Client {
+	options.Engines = DefaultEngines()
+	options.Engines["mock"] = mock
+	options.ProviderModel = testProviderModel
+	return NewClient(options)
+}
+
+// testObserver counts calls and tokens of requests to engines.
+type testObserver struct {
+	calls  []EngineCall
+	reject error
+}
+
+func (o *testObserver) BeforeCall(ctx context.Context, call *EngineCall) error {
+	return o.reject
+}
+
+func (o *testObserver) AfterCall(ctx context.Context, call *EngineCall) {
+	o.calls = append(o.calls, *call)
+}
+
+func TestAskEcho(t *testing.T) {
+	client := testClient(NewMockEngine(MockConfig{}), Options{})
+	message := UserMessage{Prompt: "Hello", Context: "world"}
+
+	responseMap, err := client.Ask(context.Background(), []string{"echo"}, message)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hello\nworld"}, responseMap["echo:echo"])
+
+	responseMap, err = client.Ask(context.Background(), []string{"echo", "mock"}, message)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"echo:echo": {"Hello\nworld"}, "mock:mock": {"Hello\nworld"}}, responseMap)
+
+	_, err = NewClient(Options{ProviderModel: testProviderModel}).Ask(context.Background(), []string{"openai:gpt-4"}, message)
+	assert.ErrorContains(t, err, "no API key found for openai")
+}
+
+func TestClientLogger(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+
+	client := testClient(NewMockEngine(MockConfig{}), Options{Logger: logger})
+	_, err := client.Ask(context.Background(), []string{"echo"}, UserMessage{Prompt: "Hello"})
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, hook.Entries)
+	assert.Regexp(t, `^Asking echo:echo: sha256:`, hook.Entries[0].Message)
+
+	// prompts are logged as the client is configured, other clients are not affected
+	hook.Reset()
+	client = testClient(NewMockEngine(MockConfig{}), Options{Logger: logger, LogPrompts: LogPromptsFull})
+	_, err = client.Ask(context.Background(), []string{"echo"}, UserMessage{Prompt: "Hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Asking echo:echo: Hello", hook.Entries[0].Message)
+}
+
+func TestMockEngineResponses(t *testing.T) {
+	path := writeMockResponses(t, `[
+		{"match": "(?i)weather", "response": "Sunny."},
+		{"match": "fail", "error": "simulated outage"}
+	]`)
+
+	engine := NewMockEngine(MockConfig{ResponsesFile: path})
+
+	responses, err := engine.AskAI(context.Background(), UserMessage{Prompt: "What is the Weather?"}, "mock", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Sunny."}, responses)
+
+	_, err = engine.AskAI(context.Background(), UserMessage{Prompt: "Please fail"}, "mock", "")
+	assert.ErrorContains(t, err, "simulated outage")
+
+	responses, err = engine.AskAI(context.Background(), UserMessage{Prompt: "Unknown"}, "mock", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Unknown"}, responses)
+}
+
+func TestMockEngineErrorRate(t *testing.T) {
+	engine := NewMockEngine(MockConfig{ErrorRate: 1})
+
+	_, err := engine.AskAI(context.Background(), UserMessage{Prompt: "Anything"}, "mock", "")
+	assert.ErrorIs(t, err, ErrMockSimulatedFailure)
+}
+
+func TestShortenTextWithMock(t *testing.T) {
+	path := writeMockResponses(t, `[{"match": "^Summarize:", "response": "Short."}]`)
+	engine := NewMockEngine(MockConfig{ResponsesFile: path})
+	observer := &testObserver{}
+	client := testClient(engine, Options{SummarizePrompt: "Summarize:", Observer: observer})
+
+	text := strings.Repeat("This sentence is rather long and needs shortening. ", 20)
+
+	shortened, err := client.ShortenText(context.Background(), "mock", text, 50)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, shortened)
+
+	tokenNum, err := engine.CalcTokenNum("mock", shortened)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, tokenNum, 50)
+
+	assert.NotEmpty(t, observer.calls)
+	for _, call := range observer.calls {
+		assert.Equal(t, CallKindSummarize, call.Kind)
+		assert.Equal(t, "mock:mock", call.EngineKey())
+		assert.Greater(t, call.PromptTokens, 0)
+	}
+
+	// text which fits is returned as is
+	calls := len(observer.calls)
+	shortened, err = client.ShortenText(context.Background(), "mock", "Short text.", 50)
+	assert.NoError(t, err)
+	assert.Equal(t, "Short text.", shortened)
+	assert.Len(t, observer.calls, calls)
+
+	_, err = client.ShortenText(context.Background(), "openai:gpt-4", "Short text.", 50)
+	assert.ErrorContains(t, err, "no API key found for openai")
+}
+
+func TestShortenTextWithEcho(t *testing.T) {
+	client := testClient(NewMockEngine(MockConfig{}), Options{SummarizePrompt: "Summarize:"})
+	text := strings.Repeat("Echo cannot shorten this text. ", 20)
+
+	_, err := client.ShortenText(context.Background(), "echo", text, 50)
+	assert.Error(t, err)
+}
+
+func TestAskObserverRejects(t *testing.T) {
+	observer := &testObserver{reject: assert.AnError}
+	client := testClient(NewMockEngine(MockConfig{}), Options{Observer: observer})
+
+	_, err := client.Ask(context.Background(), []string{"echo"}, UserMessage{Prompt: "Hello"})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, observer.calls)
+}
+
+func TestAskFallbackChain(t *testing.T) {
+	client := testClient(NewMockEngine(MockConfig{ErrorRate: 1}), Options{FallbackPolicy: FallbackPolicyRetryable})
+	message := UserMessage{Prompt: "Hello"}
+
+	responseMap, err := client.Ask(context.Background(), []string{"mock>echo"}, message)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hello"}, responseMap["echo:echo"])
+
+	client = testClient(NewMockEngine(MockConfig{ErrorRate: 1}), Options{FallbackPolicy: FallbackPolicyNone})
+	_, err = client.Ask(context.Background(), []string{"mock>echo"}, message)
+	assert.ErrorIs(t, err, ErrMockSimulatedFailure)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, IsRetryableError(fmt.Errorf("wrapped: %w", &gogpt.APIError{StatusCode: 503})))
+	assert.True(t, IsRetryableError(&cohere.APIError{StatusCode: 429}))
+	assert.False(t, IsRetryableError(&gogpt.APIError{StatusCode: 401}))
+	assert.False(t, IsRetryableError(fmt.Errorf("no API key found for openai")))
+}
+
+func TestAskFirst(t *testing.T) {
+	client := testClient(NewMockEngine(MockConfig{Latency: "10s"}), Options{})
+	message := UserMessage{Prompt: "Hello"}
+
+	check, err := NewResponseCheck("")
+	assert.NoError(t, err)
+
+	start := time.Now()
+	responseMap, err := client.AskFirst(context.Background(), []string{"mock", "echo"}, message, check)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"echo:echo": {"Hello"}}, responseMap)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	check, err = NewResponseCheck("^Bye")
+	assert.NoError(t, err)
+
+	_, err = client.AskFirst(context.Background(), []string{"echo"}, message, check)
+	assert.Error(t, err)
+}
+
+func TestEngineNames(t *testing.T) {
+	aiProvider, aiModel, err := SplitEngineName("openai:gpt-4")
+	assert.NoError(t, err)
+	assert.Equal(t, "openai", aiProvider)
+	assert.Equal(t, "gpt-4", aiModel)
+
+	assert.Equal(t, []string{"openai", "cohere"}, SplitEngineChain(" openai > cohere>"))
+	assert.Equal(t, []string{"openai", "cohere", "echo"}, ExpandEngineChains([]string{"openai>cohere", "echo"}))
+}
@@ -0,0 +1,127 @@
+package askai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	cohere "github.com/cohere-ai/cohere-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const MaxTokensCohere = 2048
+
+// cohereAPIVersion is the version of API cohere client uses.
+const cohereAPIVersion = "2021-11-08"
+
+// cohereBaseURL is a variable, so tests can replace the API with a local server.
+var cohereBaseURL = "https://api.cohere.ai/"
+
+func askCohere(ctx context.Context, message UserMessage, model string, tok *Tokenizer, apiKey string) ([]string, error) {
+	prompt := message.GetFullPrompt()
+
+	maxTokens, err := tok.CalcModelMaxResponseSize(prompt, MaxTokensCohere)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newCohereClient(ctx, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cohere client: %w", err)
+	}
+
+	response, err := client.Generate(
+		cohere.GenerateOptions{
+			Prompt:    prompt,
+			Model:     model,
+			MaxTokens: uint(maxTokens),
+		})
+
+	if err != nil {
+		return nil, fmt.Errorf("cohere could not generate text completion: %w", err)
+	}
+
+	result := make([]string, 0, len(response.Generations))
+	for _, generation := range response.Generations {
+		result = append(result, generation.Text)
+	}
+
+	return result, nil
+}
+
+// newCohereClient creates cohere client with requests bound to ctx and checks the API key the way
+// cohere.CreateClient does, which sends the check with http.DefaultClient, so it can't be canceled.
+func newCohereClient(ctx context.Context, apiKey string) (*cohere.Client, error) {
+	client := &cohere.Client{
+		APIKey:  apiKey,
+		BaseURL: cohereBaseURL,
+		Client:  http.Client{Transport: contextTransport{ctx: ctx, base: http.DefaultTransport}},
+		Version: cohereAPIVersion,
+	}
+
+	data, err := client.CheckAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var check cohere.CheckAPIKeyResponse
+	if err = json.Unmarshal(data, &check); err != nil {
+		return nil, err
+	}
+
+	if !check.Valid {
+		return nil, errors.New("invalid api key")
+	}
+
+	return client, nil
+}
+
+// contextTransport binds requests of cohere client, which doesn't accept context, to the given context.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+type CohereEngine struct {
+	// Tokenizer configures tokenizers of the engine.
+	Tokenizer TokenizerConfig
+	// Logger gets warnings of tokenizers of the engine, the standard logger of logrus is used if it's nil.
+	Logger log.Ext1FieldLogger
+}
+
+func (e *CohereEngine) AskAI(ctx context.Context, message UserMessage, model string, apiKey string) ([]string, error) {
+	return askCohere(ctx, message, model, NewTokenizerWithConfig(CohereEncoding, e.Tokenizer, e.Logger), apiKey)
+}
+
+func (e *CohereEngine) GetMaxTokenLimit(model string) int {
+	return MaxTokensCohere
+}
+
+func (e *CohereEngine) GetTokenizationEncoding(model string) (string, error) {
+	return CohereEncoding, nil
+}
+
+func (e *CohereEngine) CalcTokenNum(model string, text string) (int, error) {
+	tok := NewTokenizerWithConfig(CohereEncoding, e.Tokenizer, e.Logger)
+	return tok.CalcTokenNum(text)
+}
+
+func (e *CohereEngine) SplitText(model string, text string, maxTokenLen int) ([]string, error) {
+	tok := NewTokenizerWithConfig(CohereEncoding, e.Tokenizer, e.Logger)
+	return tok.SplitText(text, maxTokenLen)
+}
+
+// ValidateAPIKey checks the key the way cohere client does on creation, the check is canceled when ctx is done.
+func (e *CohereEngine) ValidateAPIKey(ctx context.Context, apiKey string) error {
+	if _, err := newCohereClient(ctx, apiKey); err != nil {
+		return fmt.Errorf("cohere could not check API key: %w", err)
+	}
+
+	return nil
+}
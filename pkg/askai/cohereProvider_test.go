@@ -0,0 +1,39 @@
+package askai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCohereValidateAPIKey(t *testing.T) {
+	savedBaseURL := cohereBaseURL
+	defer func() { cohereBaseURL = savedBaseURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "BEARER valid-key":
+			w.Write([]byte(`{"valid": true}`))
+		case "BEARER slow-key":
+			<-r.Context().Done()
+		default:
+			w.Write([]byte(`{"valid": false}`))
+		}
+	}))
+	defer server.Close()
+	cohereBaseURL = server.URL + "/"
+
+	engine := &CohereEngine{}
+	assert.NoError(t, engine.ValidateAPIKey(context.Background(), "valid-key"))
+	assert.ErrorContains(t, engine.ValidateAPIKey(context.Background(), "invalid-key"), "invalid api key")
+
+	// the request itself is canceled, nothing is left running
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := engine.ValidateAPIKey(ctx, "slow-key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,25 @@
+// Package askai asks AI engines like OpenAI and Cohere models: it fans a message out to several engines,
+// falls back along engine chains like "openai>cohere", races engines for the first good answer,
+// and summarizes input which doesn't fit into the token limit of an engine.
+// It's the core of askai command line tool.
+//
+// A client is configured with models and API keys of providers:
+//
+//	client := askai.NewClient(askai.Options{
+//		ProviderModel:   map[string]string{"openai": "gpt-3.5-turbo", "cohere": "command"},
+//		APIKeys:         map[string]string{"openai": os.Getenv("OPENAI_API_KEY")},
+//		SummarizePrompt: "Summarize the following text:",
+//	})
+//
+//	responses, err := client.Ask(ctx, []string{"openai", "cohere:command-light"},
+//		askai.UserMessage{Prompt: "Explain this error", Context: logText})
+//
+// Tokenizers of engines count tokens and split text into parts at boundaries of sentences,
+// code blocks or log records. Their fallback, content type and overlap are set per client by Options.Tokenizer
+// or per engine, see NewEngines. InitTokenizers configures where BPE files of tiktoken encodings are cached,
+// it's a setting of the whole process, not of a client, and should be called once.
+//
+// A client logs with the logrus logger of Options, the standard one by default, prompts are logged
+// as LogPrompts of Options says. Requests are traced with the global OpenTelemetry tracer provider,
+// CallObserver gets every request sent to engines, e.g. to audit it.
+package askai
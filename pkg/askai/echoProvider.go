@@ -0,0 +1,40 @@
+package askai
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const MaxTokensEcho = 4096
+
+// EchoEngine is a built-in engine which answers with the prompt it was given.
+// It doesn't need an API key or network access.
+type EchoEngine struct {
+	// Tokenizer configures tokenizers of the engine.
+	Tokenizer TokenizerConfig
+	// Logger gets warnings of tokenizers of the engine, the standard logger of logrus is used if it's nil.
+	Logger log.Ext1FieldLogger
+}
+
+func (e *EchoEngine) AskAI(ctx context.Context, message UserMessage, model string, apiKey string) ([]string, error) {
+	return []string{message.GetFullPrompt()}, nil
+}
+
+func (e *EchoEngine) GetMaxTokenLimit(model string) int {
+	return MaxTokensEcho
+}
+
+func (e *EchoEngine) GetTokenizationEncoding(model string) (string, error) {
+	return "", nil
+}
+
+func (e *EchoEngine) CalcTokenNum(model string, text string) (int, error) {
+	tok := NewTokenizerWithConfig("", e.Tokenizer, e.Logger)
+	return tok.CalcTokenNum(text)
+}
+
+func (e *EchoEngine) SplitText(model string, text string, maxTokenLen int) ([]string, error) {
+	tok := NewTokenizerWithConfig("", e.Tokenizer, e.Logger)
+	return tok.SplitText(text, maxTokenLen)
+}
@@ -0,0 +1,98 @@
+package askai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EngineChainSeparator separates engines of a fallback chain like "openai>cohere".
+const EngineChainSeparator = ">"
+
+type AIEngine interface {
+	AskAI(ctx context.Context, message UserMessage, model string, apiKey string) ([]string, error)
+	GetMaxTokenLimit(model string) int
+	GetTokenizationEncoding(model string) (string, error)
+	CalcTokenNum(model string, text string) (int, error)
+	SplitText(model string, text string, maxTokenLen int) ([]string, error)
+}
+
+// APIKeyValidator is implemented by engines which can check an API key with the provider before it's saved.
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, apiKey string) error
+}
+
+// testEngines don't call any external API, so they need no API key
+// and are not included when all engines are requested.
+var testEngines = map[string]bool{
+	"echo": true,
+	"mock": true,
+}
+
+// DefaultEngines returns new instances of all built-in engines by their provider names.
+func DefaultEngines() map[string]AIEngine {
+	return NewEngines(TokenizerConfig{}, nil)
+}
+
+// NewEngines returns new instances of all built-in engines by their provider names,
+// their tokenizers use the config and log warnings to the logger, the standard logger of logrus if it's nil.
+func NewEngines(config TokenizerConfig, logger log.Ext1FieldLogger) map[string]AIEngine {
+	mock := NewMockEngine(MockConfig{})
+	mock.Tokenizer = config
+	mock.Logger = logger
+
+	return map[string]AIEngine{
+		"openai": &OpenAIEngine{Tokenizer: config, Logger: logger},
+		"cohere": &CohereEngine{Tokenizer: config, Logger: logger},
+		"echo":   &EchoEngine{Tokenizer: config, Logger: logger},
+		"mock":   mock,
+	}
+}
+
+// IsTestEngine reports whether the provider is a built-in engine which needs no API key, like echo and mock.
+func IsTestEngine(aiProvider string) bool {
+	return testEngines[aiProvider]
+}
+
+// SplitEngineName splits engine name like "openai:gpt-4" into the provider and the model, which may be empty.
+func SplitEngineName(engineName string) (string, string, error) {
+	parts := strings.Split(engineName, ":")
+	if len(parts) == 0 {
+		return "", "", fmt.Errorf("failed to split engine name: %s", engineName)
+	}
+
+	aiProvider := strings.TrimSpace(parts[0])
+	aiModel := ""
+	if len(parts) > 1 {
+		aiModel = strings.TrimSpace(parts[1])
+	}
+
+	return aiProvider, aiModel, nil
+}
+
+// SplitEngineChain splits engine chain like "openai>cohere>mock" into engine names.
+func SplitEngineChain(chain string) []string {
+	parts := strings.Split(chain, EngineChainSeparator)
+
+	engines := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			engines = append(engines, part)
+		}
+	}
+
+	return engines
+}
+
+// ExpandEngineChains returns all engines participating in the given engine chains.
+func ExpandEngineChains(chains []string) []string {
+	engines := make([]string, 0, len(chains))
+	for _, chain := range chains {
+		engines = append(engines, SplitEngineChain(chain)...)
+	}
+
+	return engines
+}
@@ -0,0 +1,106 @@
+package askai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	cohere "github.com/cohere-ai/cohere-go"
+	gogpt "github.com/sashabaranov/go-gpt3"
+)
+
+// Fallback policies define when the next engine of a chain is tried after a failure.
+const (
+	FallbackPolicyRetryable = "retryable"
+	FallbackPolicyAny       = "any"
+	FallbackPolicyNone      = "none"
+)
+
+func isHTTPStatusRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// IsRetryableError reports whether the error is a transient failure of AI provider,
+// i.e. the provider is overloaded, unavailable or unreachable.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrMockSimulatedFailure) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var openaiAPIError *gogpt.APIError
+	if errors.As(err, &openaiAPIError) {
+		return isHTTPStatusRetryable(openaiAPIError.StatusCode)
+	}
+
+	var openaiRequestError *gogpt.RequestError
+	if errors.As(err, &openaiRequestError) {
+		return isHTTPStatusRetryable(openaiRequestError.StatusCode)
+	}
+
+	var cohereAPIError *cohere.APIError
+	if errors.As(err, &cohereAPIError) {
+		return isHTTPStatusRetryable(cohereAPIError.StatusCode)
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+// ShouldFallback reports whether the next engine of a chain is tried after the error according to the policy.
+func ShouldFallback(err error, policy string) bool {
+	switch policy {
+	case FallbackPolicyAny:
+		return true
+	case FallbackPolicyNone:
+		return false
+	default:
+		return IsRetryableError(err)
+	}
+}
+
+// AskChain asks engines of the chain like "openai>cohere" one by one until one of them answers.
+// The next engine is tried only if the failure of the previous one is allowed by fallback policy.
+func (c *Client) AskChain(ctx context.Context, chain string, message UserMessage) EngineCallResult {
+	engines := SplitEngineChain(chain)
+	if len(engines) == 0 {
+		return EngineCallResult{"", nil, fmt.Errorf("no AI engine found in %q", chain)}
+	}
+
+	var result EngineCallResult
+
+	for i, engine := range engines {
+		aiProvider, aiModel, err := SplitEngineName(engine)
+		if err != nil {
+			return EngineCallResult{"", nil, err}
+		}
+
+		result = c.callEngine(ctx, aiProvider, aiModel, message)
+		if result.Err == nil {
+			if i > 0 {
+				c.options.Logger.Infof("Engine chain %s: answered by %s", chain, result.EngineKey)
+			}
+			return result
+		}
+
+		if i+1 == len(engines) || ctx.Err() != nil {
+			break
+		}
+
+		if !ShouldFallback(result.Err, c.options.FallbackPolicy) {
+			c.options.Logger.Infof("Engine chain %s: error of %s is not retryable, no fallback", chain, engine)
+			break
+		}
+
+		c.options.Logger.Warningf("Engine chain %s: %s failed, falling back to %s", chain, engine, engines[i+1])
+	}
+
+	return result
+}
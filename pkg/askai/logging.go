@@ -0,0 +1,51 @@
+package askai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Ways to write prompts and responses to the log.
+const (
+	LogPromptsHash     = "hash"
+	LogPromptsTruncate = "truncate"
+	LogPromptsFull     = "full"
+)
+
+const logTruncatedTextLen = 80
+
+const logHashLen = 12
+
+func IsValidLogPromptMode(mode string) bool {
+	return mode == LogPromptsHash || mode == LogPromptsTruncate || mode == LogPromptsFull
+}
+
+// LogText makes the text safe to log according to the mode: it's replaced with its hash (the default)
+// or truncated unless the mode is full.
+func LogText(mode string, text string) string {
+	switch mode {
+	case LogPromptsFull:
+		return text
+	case LogPromptsTruncate:
+		if utf8.RuneCountInString(text) <= logTruncatedTextLen {
+			return text
+		}
+
+		runes := []rune(text)
+		return fmt.Sprintf("%s... (%d chars)", string(runes[:logTruncatedTextLen]), len(runes))
+	default:
+		sum := sha256.Sum256([]byte(text))
+		return fmt.Sprintf("sha256:%s (%d chars)", hex.EncodeToString(sum[:])[:logHashLen], utf8.RuneCountInString(text))
+	}
+}
+
+func LogTexts(mode string, texts []string) []string {
+	logged := make([]string, 0, len(texts))
+	for _, text := range texts {
+		logged = append(logged, LogText(mode, text))
+	}
+
+	return logged
+}
@@ -0,0 +1,24 @@
+package askai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogText(t *testing.T) {
+	text := strings.Repeat("secret plan ", 10)
+
+	logged := LogText(LogPromptsHash, text)
+	assert.NotContains(t, logged, "secret")
+	assert.Regexp(t, `^sha256:[0-9a-f]{12} \(120 chars\)$`, logged)
+	assert.Equal(t, logged, LogText(LogPromptsHash, text))
+	assert.NotEqual(t, logged, LogText(LogPromptsHash, "other"))
+	assert.Equal(t, logged, LogText("", text))
+
+	assert.Equal(t, strings.Repeat("secret plan ", 6)+"secret p... (120 chars)", LogText(LogPromptsTruncate, text))
+	assert.Equal(t, "short", LogText(LogPromptsTruncate, "short"))
+
+	assert.Equal(t, []string{text}, LogTexts(LogPromptsFull, []string{text}))
+}
@@ -0,0 +1,24 @@
+package askai
+
+// UserMessage is a request to AI engines: the prompt with the context it's about, like text read from stdin.
+type UserMessage struct {
+	Prompt  string
+	Context string
+}
+
+// GetFullPrompt returns the prompt followed by the context, as it's sent to an engine.
+func (message UserMessage) GetFullPrompt() string {
+	return MakeFullPrompt(message.Prompt, message.Context)
+}
+
+func MakeFullPrompt(prompt string, context string) string {
+	if prompt != "" && context != "" {
+		return prompt + "\n" + context
+	} else if prompt != "" {
+		return prompt
+	} else if context != "" {
+		return context
+	}
+
+	return ""
+}
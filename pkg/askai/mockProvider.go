@@ -0,0 +1,177 @@
+package askai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const MaxTokensMock = 4096
+
+// MockConfig configures the built-in mock engine.
+type MockConfig struct {
+	ResponsesFile string  `json:"responsesfile"`
+	Latency       string  `json:"latency"`
+	ErrorRate     float64 `json:"errorrate"`
+	MaxTokens     int     `json:"maxtokens"`
+}
+
+// MockResponse is a canned answer returned when the full prompt matches Match.
+// If Error is set, the mock engine fails with it instead of answering.
+type MockResponse struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+	Error    string `json:"error"`
+}
+
+type mockRule struct {
+	re       *regexp.Regexp
+	response MockResponse
+}
+
+// MockEngine is a built-in engine which answers with canned responses keyed by regex,
+// falling back to echoing the prompt. It can simulate latency and failures.
+type MockEngine struct {
+	// Tokenizer configures tokenizers of the engine.
+	Tokenizer TokenizerConfig
+	// Logger gets warnings of tokenizers of the engine, the standard logger of logrus is used if it's nil.
+	Logger log.Ext1FieldLogger
+
+	config    MockConfig
+	latency   time.Duration
+	rules     []mockRule
+	loadOnce  sync.Once
+	loadError error
+}
+
+// ErrMockSimulatedFailure is the error of failures simulated by the mock engine.
+var ErrMockSimulatedFailure = errors.New("mock engine simulated failure")
+
+func NewMockEngine(config MockConfig) *MockEngine {
+	return &MockEngine{config: config}
+}
+
+func (e *MockEngine) load() error {
+	e.loadOnce.Do(func() {
+		if e.config.Latency != "" {
+			latency, err := time.ParseDuration(e.config.Latency)
+			if err != nil {
+				e.loadError = fmt.Errorf("invalid mock latency: %w", err)
+				return
+			}
+			e.latency = latency
+		}
+
+		if e.config.ResponsesFile == "" {
+			return
+		}
+
+		data, err := os.ReadFile(e.config.ResponsesFile)
+		if err != nil {
+			e.loadError = fmt.Errorf("failed to read mock responses file: %w", err)
+			return
+		}
+
+		var responses []MockResponse
+		if err = json.Unmarshal(data, &responses); err != nil {
+			e.loadError = fmt.Errorf("failed to deserialize mock responses file: %w", err)
+			return
+		}
+
+		for _, response := range responses {
+			re, err := regexp.Compile(response.Match)
+			if err != nil {
+				e.loadError = fmt.Errorf("invalid mock response pattern %q: %w", response.Match, err)
+				return
+			}
+			e.rules = append(e.rules, mockRule{re: re, response: response})
+		}
+	})
+
+	return e.loadError
+}
+
+func (e *MockEngine) AskAI(ctx context.Context, message UserMessage, model string, apiKey string) ([]string, error) {
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+
+	if e.latency > 0 {
+		select {
+		case <-time.After(e.latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if e.config.ErrorRate > 0 && rand.Float64() < e.config.ErrorRate {
+		return nil, ErrMockSimulatedFailure
+	}
+
+	prompt := message.GetFullPrompt()
+
+	for _, rule := range e.rules {
+		if !rule.re.MatchString(prompt) {
+			continue
+		}
+
+		if rule.response.Error != "" {
+			return nil, fmt.Errorf("%w: %s", ErrMockSimulatedFailure, rule.response.Error)
+		}
+
+		return []string{rule.response.Response}, nil
+	}
+
+	return []string{prompt}, nil
+}
+
+// ValidateAPIKey stands in for a provider's key check, it accepts any key but simulates latency and failures.
+func (e *MockEngine) ValidateAPIKey(ctx context.Context, apiKey string) error {
+	if err := e.load(); err != nil {
+		return err
+	}
+
+	if e.latency > 0 {
+		select {
+		case <-time.After(e.latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if e.config.ErrorRate > 0 && rand.Float64() < e.config.ErrorRate {
+		return ErrMockSimulatedFailure
+	}
+
+	return nil
+}
+
+func (e *MockEngine) GetMaxTokenLimit(model string) int {
+	if e.config.MaxTokens > 0 {
+		return e.config.MaxTokens
+	}
+
+	return MaxTokensMock
+}
+
+func (e *MockEngine) GetTokenizationEncoding(model string) (string, error) {
+	return "", nil
+}
+
+func (e *MockEngine) CalcTokenNum(model string, text string) (int, error) {
+	tok := NewTokenizerWithConfig("", e.Tokenizer, e.Logger)
+	return tok.CalcTokenNum(text)
+}
+
+func (e *MockEngine) SplitText(model string, text string, maxTokenLen int) ([]string, error) {
+	tok := NewTokenizerWithConfig("", e.Tokenizer, e.Logger)
+	return tok.SplitText(text, maxTokenLen)
+}
@@ -1,4 +1,4 @@
-package main
+package askai
 
 import (
 	"context"
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkoukk/tiktoken-go"
 	gogpt "github.com/sashabaranov/go-gpt3"
+	log "github.com/sirupsen/logrus"
 )
 
 const MessageTokensNumChat = 7
@@ -14,16 +15,14 @@ const ReservedTokensNumChat = MessageTokensNumChat + 1 // +1, otherwise API retu
 const MaxTokensGPT3dot5Chat = 4096 - ReservedTokensNumChat
 const MaxTokensGPT3dot5 = 4000
 
-func askOpenAIChatCompletionModel(message UserMessage, model string, encoding string, apiKey string) ([]string, error) {
+func askOpenAIChatCompletionModel(ctx context.Context, message UserMessage, model string, tok *Tokenizer, apiKey string) ([]string, error) {
 	prompt := message.GetFullPrompt()
 
-	tok := NewTokenizer(encoding)
 	maxTokens, err := tok.CalcModelMaxResponseSize(prompt, MaxTokensGPT3dot5Chat)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
 	client := gogpt.NewClient(apiKey)
 
 	completionMessage := gogpt.ChatCompletionMessage{Role: "user", Content: prompt}
@@ -50,16 +49,14 @@ func askOpenAIChatCompletionModel(message UserMessage, model string, encoding st
 	return responses, nil
 }
 
-func askOpenAICompletionModel(message UserMessage, model string, encoding string, apiKey string) ([]string, error) {
+func askOpenAICompletionModel(ctx context.Context, message UserMessage, model string, tok *Tokenizer, apiKey string) ([]string, error) {
 	prompt := message.GetFullPrompt()
 
-	tok := NewTokenizer(encoding)
 	maxTokens, err := tok.CalcModelMaxResponseSize(prompt, MaxTokensGPT3dot5)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
 	client := gogpt.NewClient(apiKey)
 
 	request := gogpt.CompletionRequest{
@@ -81,22 +78,27 @@ func askOpenAICompletionModel(message UserMessage, model string, encoding string
 	return responses, nil
 }
 
-func askOpenAI(message UserMessage, model string, encoding string, apiKey string) ([]string, error) {
+func askOpenAI(ctx context.Context, message UserMessage, model string, tok *Tokenizer, apiKey string) ([]string, error) {
 	if model == gogpt.GPT3Dot5Turbo || model == gogpt.GPT3Dot5Turbo0301 {
-		return askOpenAIChatCompletionModel(message, model, encoding, apiKey)
+		return askOpenAIChatCompletionModel(ctx, message, model, tok, apiKey)
 	}
 
-	return askOpenAICompletionModel(message, model, encoding, apiKey)
+	return askOpenAICompletionModel(ctx, message, model, tok, apiKey)
 }
 
-type OpenAIEngine struct{}
+type OpenAIEngine struct {
+	// Tokenizer configures tokenizers of the engine.
+	Tokenizer TokenizerConfig
+	// Logger gets warnings of tokenizers of the engine, the standard logger of logrus is used if it's nil.
+	Logger log.Ext1FieldLogger
+}
 
-func (e *OpenAIEngine) AskAI(message UserMessage, model string, apiKey string) ([]string, error) {
+func (e *OpenAIEngine) AskAI(ctx context.Context, message UserMessage, model string, apiKey string) ([]string, error) {
 	encoding, err := e.GetTokenizationEncoding(model)
 	if err != nil {
 		return nil, err
 	}
-	return askOpenAI(message, model, encoding, apiKey)
+	return askOpenAI(ctx, message, model, NewTokenizerWithConfig(encoding, e.Tokenizer, e.Logger), apiKey)
 }
 
 func (e *OpenAIEngine) GetMaxTokenLimit(model string) int {
@@ -114,12 +116,21 @@ func (e *OpenAIEngine) GetTokenizationEncoding(model string) (string, error) {
 
 func (e *OpenAIEngine) CalcTokenNum(model string, text string) (int, error) {
 	encoding := tiktoken.MODEL_TO_ENCODING[model]
-	tok := NewTokenizer(encoding)
+	tok := NewTokenizerWithConfig(encoding, e.Tokenizer, e.Logger)
 	return tok.CalcTokenNum(text)
 }
 
 func (e *OpenAIEngine) SplitText(model string, text string, maxTokenLen int) ([]string, error) {
 	encoding := tiktoken.MODEL_TO_ENCODING[model]
-	tok := NewTokenizer(encoding)
+	tok := NewTokenizerWithConfig(encoding, e.Tokenizer, e.Logger)
 	return tok.SplitText(text, maxTokenLen)
 }
+
+func (e *OpenAIEngine) ValidateAPIKey(ctx context.Context, apiKey string) error {
+	client := gogpt.NewClient(apiKey)
+	if _, err := client.ListModels(ctx); err != nil {
+		return fmt.Errorf("openai could not list models: %w", err)
+	}
+
+	return nil
+}
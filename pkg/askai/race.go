@@ -0,0 +1,86 @@
+package askai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ResponseCheck decides whether responses of an engine are good enough to be returned.
+type ResponseCheck func(responses []string) bool
+
+// NewResponseCheck makes a check which accepts responses with non-empty text
+// matching the given regular expression, if any.
+func NewResponseCheck(pattern string) (ResponseCheck, error) {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response pattern: %w", err)
+		}
+	}
+
+	return func(responses []string) bool {
+		for _, response := range responses {
+			if strings.TrimSpace(response) == "" {
+				continue
+			}
+
+			if re == nil || re.MatchString(response) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// AskFirst asks all engines simultaneously and returns responses of the first engine
+// whose answer passes the check. Requests to other engines are cancelled.
+func (c *Client) AskFirst(ctx context.Context, engines []string, message UserMessage,
+	check ResponseCheck) (map[string][]string, error) {
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no AI engine found")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resultChannel := make(chan EngineCallResult, len(engines))
+	processEngineAsync := func(engine string) {
+		callResult := c.AskChain(ctx, engine, message)
+		if callResult.Err != nil {
+			callResult.Err = fmt.Errorf("%s: %w", engine, callResult.Err)
+		}
+		resultChannel <- callResult
+	}
+
+	for _, engine := range engines {
+		go processEngineAsync(engine)
+	}
+
+	errs := make([]error, 0, len(engines))
+
+	for i := 0; i != len(engines); i++ {
+		callResult := <-resultChannel
+		if callResult.Err != nil {
+			errs = append(errs, callResult.Err)
+			continue
+		}
+
+		if !check(callResult.Responses) {
+			c.options.Logger.Infof("Engine %s: answer was rejected by the check", callResult.EngineKey)
+			errs = append(errs, fmt.Errorf("%s: answer was rejected by the check", callResult.EngineKey))
+			continue
+		}
+
+		c.options.Logger.Infof("Engine %s answered first", callResult.EngineKey)
+
+		return map[string][]string{callResult.EngineKey: callResult.Responses}, nil
+	}
+
+	return nil, fmt.Errorf("no engine gave an acceptable answer: %w", errors.Join(errs...))
+}
@@ -0,0 +1,406 @@
+package askai
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	contentTypeAuto     = "auto"
+	contentTypeProse    = "prose"
+	contentTypeMarkdown = "markdown"
+	contentTypeCode     = "code"
+	contentTypeLog      = "log"
+)
+
+// TextSplitter finds boundaries of segments text can be split at.
+type TextSplitter interface {
+	// SegmentEnds returns byte offsets where segments of the text end, the last one is the end of the text.
+	SegmentEnds(text string) []int
+}
+
+type proseSplitter struct{}
+type markdownSplitter struct{}
+type codeSplitter struct{}
+type logSplitter struct{}
+type lineSplitter struct{}
+
+// splitterChains lists splitters for each content type from the coarsest to the finest.
+// A segment which doesn't fit into a part is split again by the next splitter.
+var splitterChains = map[string][]TextSplitter{
+	contentTypeProse:    {proseSplitter{}},
+	contentTypeMarkdown: {markdownSplitter{}, proseSplitter{}},
+	contentTypeCode:     {codeSplitter{}, lineSplitter{}},
+	contentTypeLog:      {logSplitter{}, lineSplitter{}, proseSplitter{}},
+}
+
+const maxAbbreviationLen = 6
+
+// abbreviations which are followed by a dot but don't end a sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "vs": true, "e.g": true, "i.e": true, "fig": true, "approx": true, "cf": true,
+}
+
+const contentDetectionLines = 200
+
+var (
+	logLineRegexp = regexp.MustCompile(
+		`^\s*(\[?\d{4}[-/]\d{2}[-/]\d{2}|\[?\d{2}:\d{2}:\d{2}|\[?[A-Z][a-z]{2} +\d{1,2} \d{2}:|time=|level=|` +
+			`\[?(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\b)`)
+	codeLineRegexp = regexp.MustCompile(
+		`^\s*(func|def|class|import|package|from\s+\S+\s+import|#include|public|private|protected|static|` +
+			`return|var|let|const|fn|impl|struct|interface|type|if\s*\(|for\s*\(|while\s*\()\b|[{};]\s*$`)
+	markdownLineRegexp = regexp.MustCompile("^(#{1,6} |```|~~~|\\s*([-*+]|\\d+\\.) )")
+)
+
+func IsValidContentType(contentType string) bool {
+	_, exists := splitterChains[contentType]
+	return exists || contentType == contentTypeAuto
+}
+
+// getSplitterChain returns splitters of the content type: auto, prose, markdown, code or log,
+// content type is detected by the text if it's auto or empty.
+func getSplitterChain(text string, contentType string) []TextSplitter {
+	if contentType == contentTypeAuto || splitterChains[contentType] == nil {
+		contentType = detectContentType(text)
+	}
+
+	return splitterChains[contentType]
+}
+
+// detectContentType guesses content type of the text by its first lines.
+func detectContentType(text string) string {
+	lines, logLines, codeLines, markdownLines := 0, 0, 0, 0
+	inFence := false
+
+	for start := 0; start < len(text) && lines < contentDetectionLines; {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+
+		line := text[start:end]
+		start = end + 1
+
+		if isBlankLine(line) {
+			continue
+		}
+		lines++
+
+		if isFenceLine(line) {
+			inFence = !inFence
+			markdownLines++
+			continue
+		}
+
+		switch {
+		case inFence:
+		case logLineRegexp.MatchString(line):
+			logLines++
+		case markdownLineRegexp.MatchString(line):
+			markdownLines++
+		case codeLineRegexp.MatchString(line):
+			codeLines++
+		}
+	}
+
+	if lines < 2 {
+		return contentTypeProse
+	}
+
+	const logShare = 0.5
+	const codeShare = 0.3
+	const markdownShare = 0.1
+
+	switch {
+	case float64(logLines) >= logShare*float64(lines):
+		return contentTypeLog
+	case float64(codeLines) >= codeShare*float64(lines):
+		return contentTypeCode
+	case float64(markdownLines) >= markdownShare*float64(lines):
+		return contentTypeMarkdown
+	default:
+		return contentTypeProse
+	}
+}
+
+func appendTextEnd(ends []int, text string) []int {
+	if len(ends) == 0 || ends[len(ends)-1] != len(text) {
+		ends = append(ends, len(text))
+	}
+
+	return ends
+}
+
+// textLine is a line of text with its line break, start and end are byte offsets.
+type textLine struct {
+	start int
+	end   int
+	text  string
+}
+
+func splitTextIntoLines(text string) []textLine {
+	lines := make([]textLine, 0)
+
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start + 1
+		}
+
+		lines = append(lines, textLine{start: start, end: end, text: text[start:end]})
+		start = end
+	}
+
+	return lines
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isFenceLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+// SegmentEnds splits prose into sentences and paragraphs.
+// Dots in decimal numbers and after common abbreviations don't end sentences.
+func (proseSplitter) SegmentEnds(text string) []int {
+	separators := []string{"...", ".", "!", "?"}
+
+	ends := make([]int, 0)
+
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "\n\n") {
+			for i < len(text) && text[i] == '\n' {
+				i++
+			}
+			ends = append(ends, i)
+			continue
+		}
+
+		sepLen := 0
+		for _, sep := range separators {
+			if strings.HasPrefix(text[i:], sep) {
+				sepLen = len(sep)
+				break
+			}
+		}
+
+		if sepLen == 0 || (sepLen == 1 && text[i] == '.' && !isSentenceEndDot(text, i)) {
+			i++
+			continue
+		}
+
+		i += sepLen
+		ends = append(ends, i)
+	}
+
+	return appendTextEnd(ends, text)
+}
+
+func isDigitByte(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isSentenceEndDot reports whether the dot at byte offset i ends a sentence.
+func isSentenceEndDot(text string, i int) bool {
+	if i > 0 && i+1 < len(text) && isDigitByte(text[i-1]) && isDigitByte(text[i+1]) {
+		return false
+	}
+
+	// find the word before the dot, dots inside of it are kept for abbreviations like "e.g."
+	start := i
+	for start > 0 && i-start <= maxAbbreviationLen {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !unicode.IsLetter(r) && r != '.' {
+			break
+		}
+		start -= size
+	}
+
+	word := strings.ToLower(strings.TrimLeft(text[start:i], "."))
+	if abbreviations[word] {
+		return false
+	}
+
+	// initials and abbreviations like "U.S.A."
+	if utf8.RuneCountInString(word) == 1 && i+1 < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[i+1:])
+		if unicode.IsLetter(next) {
+			return false
+		}
+	}
+
+	// sentences don't start with a lowercase letter
+	rest := strings.TrimLeft(text[i+1:], " ")
+	next, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsLower(next)
+}
+
+// SegmentEnds splits Markdown into headed sections, paragraphs and fenced code blocks,
+// code blocks are never split.
+func (markdownSplitter) SegmentEnds(text string) []int {
+	ends := make([]int, 0)
+	inFence := false
+
+	for _, line := range splitTextIntoLines(text) {
+		switch {
+		case isFenceLine(line.text):
+			if !inFence {
+				ends = append(ends, line.start)
+			} else {
+				ends = append(ends, line.end)
+			}
+			inFence = !inFence
+		case inFence:
+		case strings.HasPrefix(line.text, "#"):
+			ends = append(ends, line.start)
+		case isBlankLine(line.text):
+			ends = append(ends, line.end)
+		}
+	}
+
+	return normalizeSegmentEnds(ends, text)
+}
+
+// normalizeSegmentEnds removes empty segments.
+func normalizeSegmentEnds(ends []int, text string) []int {
+	normalized := make([]int, 0, len(ends)+1)
+
+	last := 0
+	for _, end := range ends {
+		if end > last {
+			normalized = append(normalized, end)
+			last = end
+		}
+	}
+
+	return appendTextEnd(normalized, text)
+}
+
+func lineIndentation(line string) int {
+	return len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+}
+
+func isCommentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", ";"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startsBlockContinuation reports whether the line continues the previous block, like "} else {".
+func startsBlockContinuation(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"}", ")", "]", "else", "elif", "except", "finally", "catch"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bracketDepthDelta counts opening minus closing brackets of a line of code,
+// skipping string literals and line comments.
+func bracketDepthDelta(line string) int {
+	delta := 0
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '/':
+			if i+1 < len(line) && line[i+1] == '/' {
+				return delta
+			}
+		case '{', '(', '[':
+			delta++
+		case '}', ')', ']':
+			delta--
+		}
+	}
+
+	return delta
+}
+
+// SegmentEnds splits source code into top-level blocks like functions and types.
+// A block ends where brackets are balanced and the next line starts at the first column.
+func (codeSplitter) SegmentEnds(text string) []int {
+	lines := splitTextIntoLines(text)
+	ends := make([]int, 0)
+
+	depth := 0
+	for i, line := range lines {
+		depth += bracketDepthDelta(line.text)
+		if depth < 0 {
+			depth = 0
+		}
+
+		if depth > 0 || isBlankLine(line.text) || isCommentLine(line.text) {
+			continue
+		}
+
+		// blank lines after the block stay with it
+		next := i + 1
+		for next < len(lines) && isBlankLine(lines[next].text) {
+			next++
+		}
+
+		if next < len(lines) && lineIndentation(lines[next].text) == 0 && !startsBlockContinuation(lines[next].text) {
+			ends = append(ends, lines[next].start)
+		}
+	}
+
+	return normalizeSegmentEnds(ends, text)
+}
+
+// SegmentEnds splits log into entries, indented lines like stack traces stay with the entry.
+func (logSplitter) SegmentEnds(text string) []int {
+	ends := make([]int, 0)
+
+	for _, line := range splitTextIntoLines(text) {
+		if lineIndentation(line.text) == 0 && !isBlankLine(line.text) {
+			ends = append(ends, line.start)
+		}
+	}
+
+	return normalizeSegmentEnds(ends, text)
+}
+
+// SegmentEnds splits text into lines.
+func (lineSplitter) SegmentEnds(text string) []int {
+	lines := splitTextIntoLines(text)
+
+	ends := make([]int, 0, len(lines))
+	for _, line := range lines {
+		ends = append(ends, line.end)
+	}
+
+	return normalizeSegmentEnds(ends, text)
+}
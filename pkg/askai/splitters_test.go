@@ -0,0 +1,88 @@
+package askai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func splitSegments(splitter TextSplitter, text string) []string {
+	segments := make([]string, 0)
+
+	start := 0
+	for _, end := range splitter.SegmentEnds(text) {
+		segments = append(segments, text[start:end])
+		start = end
+	}
+
+	return segments
+}
+
+func TestProseSplitterDecimalsAndAbbreviations(t *testing.T) {
+	const s1 = "Pi is about 3.14 and e.g. Dr. Smith knows it."
+	const s2 = " The U.S. team agreed!"
+	const s3 = " Really?"
+
+	segments := splitSegments(proseSplitter{}, s1+s2+s3)
+	assert.Equal(t, []string{s1, s2, s3}, segments)
+}
+
+func TestProseSplitterParagraphs(t *testing.T) {
+	const p1 = "First paragraph without a dot\n\n"
+	const p2 = "Second one"
+
+	segments := splitSegments(proseSplitter{}, p1+p2)
+	assert.Equal(t, []string{p1, p2}, segments)
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	const s1 = "# Title\nIntro text. More text.\n\n"
+	const s2 = "```go\nfmt.Println(\"a.b\")\n\nfmt.Println(\"c\")\n```\n"
+	const s3 = "## Section\nBody."
+
+	segments := splitSegments(markdownSplitter{}, s1+s2+s3)
+	assert.Equal(t, []string{s1, s2, s3}, segments)
+}
+
+func TestCodeSplitter(t *testing.T) {
+	const s1 = "package main\n\n"
+	const s2 = "// f does something.\nfunc f() {\n\tobj.method()\n\n\treturn\n}\n\n"
+	const s3 = "func g() {\n\tif a {\n\t} else {\n\t}\n}\n"
+
+	segments := splitSegments(codeSplitter{}, s1+s2+s3)
+	assert.Equal(t, []string{s1, s2, s3}, segments)
+}
+
+func TestLogSplitter(t *testing.T) {
+	const s1 = "2023-03-01 10:00:00 INFO started\n"
+	const s2 = "2023-03-01 10:00:01 ERROR failed\n\tat main.go:10\n\tat main.go:20\n"
+	const s3 = "2023-03-01 10:00:02 INFO stopped"
+
+	segments := splitSegments(logSplitter{}, s1+s2+s3)
+	assert.Equal(t, []string{s1, s2, s3}, segments)
+}
+
+func TestDetectContentType(t *testing.T) {
+	assert.Equal(t, contentTypeProse, detectContentType("Just a sentence. And another one."))
+	assert.Equal(t, contentTypeLog, detectContentType(
+		"2023-03-01 10:00:00 INFO started\n2023-03-01 10:00:01 ERROR failed\n"))
+	assert.Equal(t, contentTypeCode, detectContentType(
+		"package main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n"))
+	assert.Equal(t, contentTypeMarkdown, detectContentType(
+		"# Title\n\nSome text about the project.\nMore text here.\n\n## Usage\nRun it.\n"))
+}
+
+func TestSplitTextCodeKeepsFunctions(t *testing.T) {
+	const f1 = "func first() {\n\ta := obj.method()\n\tb := 3.14\n\treturn a + b\n}\n\n"
+	const f2 = "func second() {\n\treturn obj.other()\n}\n"
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(f1)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(f1+f2, tokenLen)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{f1, f2}, parts)
+}
@@ -0,0 +1,51 @@
+package askai
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TelemetryName is the name of the tracer of the package.
+const TelemetryName = "github.com/ilia-funtov/askai"
+
+type shortenLevelKey struct{}
+
+// tracer delegates to the global tracer provider, so spans are no-ops until the application sets it.
+var tracer = otel.Tracer(TelemetryName)
+
+// endSpan records the error, if any, in the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// startProviderCallSpan starts span of a request to the AI provider.
+func startProviderCallSpan(ctx context.Context, call EngineCall) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "AIEngine.AskAI",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("askai.kind", call.Kind),
+			attribute.String("askai.provider", call.Provider),
+			attribute.String("askai.model", call.Model),
+		))
+}
+
+// startShortenSpan starts span of a summarization step, nested steps get increasing levels.
+func startShortenSpan(ctx context.Context, name string, tokens int, maxTokens int) (context.Context, trace.Span) {
+	level, _ := ctx.Value(shortenLevelKey{}).(int)
+	ctx = context.WithValue(ctx, shortenLevelKey{}, level+1)
+
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.Int("askai.shorten.level", level),
+		attribute.Int("askai.shorten.tokens", tokens),
+		attribute.Int("askai.shorten.max_tokens", maxTokens),
+	))
+}
@@ -0,0 +1,9 @@
+//go:build tiktoken_embedded
+
+package askai
+
+import tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+
+func init() {
+	embeddedBpeLoader = tiktoken_loader.NewOfflineLoader()
+}
@@ -0,0 +1,231 @@
+package askai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Ways to count tokens if tiktoken encoding can't be loaded.
+const (
+	TokenizerFallbackRough = "rough"
+	TokenizerFallbackError = "error"
+)
+
+const bpeDownloadTimeout = 2 * time.Minute
+
+// EncodingCacheConfig configures loading of BPE files of tiktoken encodings.
+// It's a setting of the process, not of a client, see InitTokenizers.
+type EncodingCacheConfig struct {
+	CacheDir string `json:"cachedir"`
+	Offline  bool   `json:"offline"`
+}
+
+// TokenizerConfig configures counting tokens and splitting text by a tokenizer, see NewTokenizerWithConfig.
+type TokenizerConfig struct {
+	Fallback    string `json:"fallback"`
+	ContentType string `json:"contenttype"`
+	Overlap     int    `json:"overlap"`
+}
+
+// embeddedBpeLoader is set if BPE files are embedded into the binary (tiktoken_embedded build tag).
+var embeddedBpeLoader tiktoken.BpeLoader
+
+var tiktokenEncodings = struct {
+	mutex     sync.Mutex
+	encodings map[string]*tiktoken.Tiktoken
+	errors    map[string]error
+	warned    map[string]bool
+}{
+	encodings: make(map[string]*tiktoken.Tiktoken),
+	errors:    make(map[string]error),
+	warned:    make(map[string]bool),
+}
+
+// cachedBpeLoader looks for BPE file in the cache directory first, then in the files embedded
+// into the binary, and at last downloads it and saves to the cache directory unless offline.
+type cachedBpeLoader struct {
+	cacheDir string
+	offline  bool
+	logger   log.Ext1FieldLogger
+}
+
+// InitTokenizers sets where BPE files of tiktoken encodings are cached and whether they may be downloaded,
+// downloads are logged to the logger, the standard logger of logrus if it's nil. tiktoken has a single loader
+// of BPE files, so it's a setting of the whole process shared by all clients: it should be called once
+// before tokenizers are used, a later call replaces the loader for all of them and keeps loaded encodings.
+func InitTokenizers(config EncodingCacheConfig, logger log.Ext1FieldLogger) {
+	tiktoken.SetBpeLoader(&cachedBpeLoader{cacheDir: config.CacheDir, offline: config.Offline, logger: orStandardLogger(logger)})
+}
+
+// orStandardLogger returns the standard logger of logrus if the logger is nil.
+func orStandardLogger(logger log.Ext1FieldLogger) log.Ext1FieldLogger {
+	if logger == nil {
+		return log.StandardLogger()
+	}
+
+	return logger
+}
+
+func (l *cachedBpeLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	fileName := path.Base(tiktokenBpeFile)
+	cachePath := filepath.Join(l.cacheDir, fileName)
+
+	contents, err := os.ReadFile(cachePath)
+	if err == nil {
+		return parseTiktokenBpe(contents)
+	}
+
+	if embeddedBpeLoader != nil {
+		return embeddedBpeLoader.LoadTiktokenBpe(tiktokenBpeFile)
+	}
+
+	if l.offline {
+		return nil, fmt.Errorf("BPE file %s is not found in %s and downloading is disabled", fileName, l.cacheDir)
+	}
+
+	l.logger.Infof("Downloading BPE file %s", tiktokenBpeFile)
+
+	contents, err = downloadBpeFile(tiktokenBpeFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ranks, err := parseTiktokenBpe(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = saveBpeFile(cachePath, contents); err != nil {
+		l.logger.Warningf("failed to save BPE file to cache: %v", err)
+	}
+
+	return ranks, nil
+}
+
+func downloadBpeFile(url string) ([]byte, error) {
+	client := http.Client{Timeout: bpeDownloadTimeout}
+
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download BPE file: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download BPE file %s: %s", url, response.Status)
+	}
+
+	contents, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download BPE file: %w", err)
+	}
+
+	return contents, nil
+}
+
+func saveBpeFile(cachePath string, contents []byte) error {
+	const dirPermissionMask = 0770
+	if err := os.MkdirAll(filepath.Dir(cachePath), dirPermissionMask); err != nil {
+		return err
+	}
+
+	// write to temporary file first, so concurrent runs never see partially written file
+	tmpFile, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(contents)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), cachePath)
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+
+	return err
+}
+
+func parseTiktokenBpe(contents []byte) (map[string]int, error) {
+	bpeRanks := make(map[string]int)
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, " ")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line in BPE file: %q", line)
+		}
+
+		token, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token in BPE file: %w", err)
+		}
+
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in BPE file: %w", err)
+		}
+
+		bpeRanks[string(token)] = rank
+	}
+
+	return bpeRanks, nil
+}
+
+// getTiktokenEncoding loads tiktoken encoding once per process, failures are remembered as well.
+func getTiktokenEncoding(encoding string) (*tiktoken.Tiktoken, error) {
+	tiktokenEncodings.mutex.Lock()
+	defer tiktokenEncodings.mutex.Unlock()
+
+	if tke, exists := tiktokenEncodings.encodings[encoding]; exists {
+		return tke, nil
+	}
+
+	if err, exists := tiktokenEncodings.errors[encoding]; exists {
+		return nil, err
+	}
+
+	tke, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		err = fmt.Errorf("tiktoken.GetEncoding: %w", err)
+		tiktokenEncodings.errors[encoding] = err
+		return nil, err
+	}
+
+	tiktokenEncodings.encodings[encoding] = tke
+	return tke, nil
+}
+
+// warnRoughEstimation warns once per encoding that it failed to load and token numbers are estimated roughly,
+// the warning goes to the logger of the tokenizer which estimated them first.
+func warnRoughEstimation(logger log.Ext1FieldLogger, encoding string, err error) {
+	tiktokenEncodings.mutex.Lock()
+	defer tiktokenEncodings.mutex.Unlock()
+
+	if tiktokenEncodings.warned[encoding] {
+		return
+	}
+
+	tiktokenEncodings.warned[encoding] = true
+	logger.Warningf("failed to load encoding %s, token numbers will be estimated roughly: %v", encoding, err)
+}
@@ -0,0 +1,42 @@
+package askai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBpeURL = "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken"
+
+func TestCachedBpeLoaderFromCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(cacheDir, "cl100k_base.tiktoken"), []byte("YQ== 0\nYg== 1\n"), 0600)
+	assert.NoError(t, err)
+
+	loader := &cachedBpeLoader{cacheDir: cacheDir, offline: true}
+
+	ranks, err := loader.LoadTiktokenBpe(testBpeURL)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 0, "b": 1}, ranks)
+}
+
+func TestCachedBpeLoaderOffline(t *testing.T) {
+	if embeddedBpeLoader != nil {
+		t.Skip("BPE files are embedded")
+	}
+
+	loader := &cachedBpeLoader{cacheDir: t.TempDir(), offline: true}
+
+	_, err := loader.LoadTiktokenBpe(testBpeURL)
+	assert.Error(t, err)
+}
+
+func TestParseTiktokenBpeInvalid(t *testing.T) {
+	_, err := parseTiktokenBpe([]byte("YQ==\n"))
+	assert.Error(t, err)
+
+	_, err = parseTiktokenBpe([]byte("YQ== x\n"))
+	assert.Error(t, err)
+}
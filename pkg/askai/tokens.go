@@ -0,0 +1,453 @@
+package askai
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cohere-ai/tokenizer"
+	log "github.com/sirupsen/logrus"
+)
+
+// CohereEncoding is the name of BPE vocabulary used by Cohere models.
+const CohereEncoding = "coheretext-50k"
+
+// rough estimation: a word is 4/3 tokens, every non-letter character is a token,
+// weights are kept in thirds of a token to stay integer
+const (
+	roughWordWeight      = 4
+	roughNonLetterWeight = 3
+	roughWeightDivisor   = 3
+)
+
+// oversizeSegmentFactor limits segments which the finest splitter can't split further, like long sentences:
+// a segment up to this many times longer than a part is kept whole in a part of its own, so sentences
+// a bit longer than the average part asked by the summarizer stay intact, longer ones are split at token boundaries.
+const oversizeSegmentFactor = 2
+
+var cohereEncoder struct {
+	once    sync.Once
+	mutex   sync.Mutex // Encoder caches words, so it's not safe for concurrent use
+	encoder *tokenizer.Encoder
+	err     error
+}
+
+// Tokenizer counts tokens of an encoding and splits text into parts, its zero config
+// splits text by detected content type without overlap and estimates tokens roughly
+// if tiktoken encoding can't be loaded.
+type Tokenizer struct {
+	encoding string
+	config   TokenizerConfig
+	logger   log.Ext1FieldLogger
+}
+
+// tokenMap maps tokens of a text to byte offsets where they start,
+// so the number of tokens in any range of the text is found without encoding it again.
+type tokenMap struct {
+	starts    []int // byte offsets of token starts in ascending order
+	weights   []int // prefix sums of token weights, len(weights) == len(starts)+1
+	divisor   int
+	textBytes int
+}
+
+func NewTokenizer(ecoding string) *Tokenizer {
+	return NewTokenizerWithConfig(ecoding, TokenizerConfig{}, nil)
+}
+
+// NewTokenizerWithConfig returns tokenizer of the encoding which uses fallback, content type and overlap of the config,
+// its warnings go to the logger, the standard logger of logrus if it's nil.
+func NewTokenizerWithConfig(encoding string, config TokenizerConfig, logger log.Ext1FieldLogger) *Tokenizer {
+	return &Tokenizer{
+		encoding: encoding,
+		config:   config,
+		logger:   orStandardLogger(logger),
+	}
+}
+
+// fallsBackRoughly reports whether tokens are estimated roughly if tiktoken encoding can't be loaded,
+// it warns about it once per encoding.
+func (t *Tokenizer) fallsBackRoughly(err error) bool {
+	if t.config.Fallback == TokenizerFallbackError {
+		return false
+	}
+
+	warnRoughEstimation(t.logger, t.encoding, err)
+	return true
+}
+
+func (t *Tokenizer) CalcTokenNum(text string) (int, error) {
+	switch t.encoding {
+	case "":
+		return calcTokenNumRoughly(text), nil
+	case CohereEncoding:
+		return calcTokenNumCohere(text)
+	default:
+		tokenNum, err := calcTokenNumExact(text, t.encoding)
+		if err != nil && t.fallsBackRoughly(err) {
+			return calcTokenNumRoughly(text), nil
+		}
+
+		return tokenNum, err
+	}
+}
+
+func (t *Tokenizer) CalcModelMaxResponseSize(prompt string, modelMaxTokens int) (int, error) {
+	tokensInPrompt, err := t.CalcTokenNum(prompt)
+	if err != nil {
+		return 0, fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	maxResponseTokens := modelMaxTokens - tokensInPrompt
+	if maxResponseTokens <= 0 {
+		return 0, fmt.Errorf("too many tokens to process")
+	}
+
+	return maxResponseTokens, nil
+}
+
+// SplitText splits text into parts of about maxTokenLen tokens each, see SplitTextWithOverlap,
+// adjacent parts share the number of overlapping tokens of the tokenizer config.
+func (t *Tokenizer) SplitText(text string, maxTokenLen int) ([]string, error) {
+	return t.SplitTextWithOverlap(text, maxTokenLen, t.config.Overlap)
+}
+
+// SplitTextWithOverlap splits text into parts of maxTokenLen tokens at most. Parts are made of segments
+// like sentences, paragraphs or functions found by splitters chosen by content type. A segment which
+// is longer than a part and can't be split further, like a long sentence, makes a part of its own if it's
+// at most twice as long as a part, longer ones are split at token boundaries. Every part but the first one starts
+// with the last overlap tokens of the previous part, overlap is limited to a half of maxTokenLen.
+// The text is encoded once, token numbers of segments are taken from the token map.
+func (t *Tokenizer) SplitTextWithOverlap(text string, maxTokenLen int, overlap int) ([]string, error) {
+	if maxTokenLen == 0 {
+		return []string{}, nil
+	}
+
+	if maxTokenLen < 0 {
+		return []string{}, fmt.Errorf("invalid maximum number of tokens in part: %d", maxTokenLen)
+	}
+
+	if overlap > maxTokenLen/2 {
+		overlap = maxTokenLen / 2
+	} else if overlap < 0 {
+		overlap = 0
+	}
+
+	tokens, err := t.tokenize(text)
+	if err != nil {
+		return []string{}, fmt.Errorf(errorMessageCalcTokenNum, err)
+	}
+
+	if tokens.count(0, len(text)) == 0 {
+		return []string{}, nil
+	}
+
+	parts := make([]string, 0)
+	appendPart := func(start int, end int) {
+		if len(parts) > 0 && overlap > 0 {
+			start = tokens.overlapStart(text, start, overlap)
+		}
+		parts = append(parts, text[start:end])
+	}
+
+	partStart := 0
+	partSize := 0
+	segmentStart := 0
+
+	// space for the overlap is reserved in every part
+	partTokenLen := maxTokenLen - overlap
+
+	segmentEnds := findSegmentEnds(text, 0, len(text), tokens, partTokenLen, getSplitterChain(text, t.config.ContentType))
+
+	for _, segmentEnd := range segmentEnds {
+		tokenNum := tokens.count(segmentStart, segmentEnd)
+
+		if (tokenNum + partSize) > partTokenLen {
+			if segmentStart > partStart {
+				appendPart(partStart, segmentStart)
+			}
+			partStart = segmentStart
+			partSize = tokenNum
+		} else {
+			partSize += tokenNum
+		}
+
+		segmentStart = segmentEnd
+	}
+
+	if len(text) > partStart {
+		appendPart(partStart, len(text))
+	}
+
+	return parts, nil
+}
+
+func (t *Tokenizer) tokenize(text string) (*tokenMap, error) {
+	switch t.encoding {
+	case "":
+		return tokenizeRoughly(text), nil
+	case CohereEncoding:
+		return tokenizeCohere(text)
+	default:
+		tokens, err := tokenizeExact(text, t.encoding)
+		if err != nil && t.fallsBackRoughly(err) {
+			return tokenizeRoughly(text), nil
+		}
+
+		return tokens, err
+	}
+}
+
+// findSegmentEnds splits text[start:end] by the first splitter of the chain,
+// segments longer than maxTokenLen tokens are split again by the next splitters. If there are
+// no more splitters, segments longer than oversizeSegmentFactor parts are split at token boundaries.
+func findSegmentEnds(text string, start int, end int, tokens *tokenMap, maxTokenLen int, chain []TextSplitter) []int {
+	ends := make([]int, 0)
+
+	segmentStart := start
+	for _, segmentEnd := range chain[0].SegmentEnds(text[start:end]) {
+		segmentEnd += start
+
+		switch {
+		case tokens.count(segmentStart, segmentEnd) <= maxTokenLen:
+			ends = append(ends, segmentEnd)
+		case len(chain) > 1:
+			ends = append(ends, findSegmentEnds(text, segmentStart, segmentEnd, tokens, maxTokenLen, chain[1:])...)
+		case tokens.count(segmentStart, segmentEnd) <= oversizeSegmentFactor*maxTokenLen:
+			ends = append(ends, segmentEnd)
+		default:
+			ends = append(ends, tokens.splitEnds(text, segmentStart, segmentEnd, maxTokenLen)...)
+		}
+
+		segmentStart = segmentEnd
+	}
+
+	return ends
+}
+
+// newTokenMapFromLengths makes token map from byte lengths of consecutive tokens.
+func newTokenMapFromLengths(text string, lengths []int) *tokenMap {
+	tokens := &tokenMap{
+		starts:    make([]int, 0, len(lengths)),
+		weights:   make([]int, 1, len(lengths)+1),
+		divisor:   1,
+		textBytes: len(text),
+	}
+
+	offset := 0
+	for _, length := range lengths {
+		if offset >= len(text) {
+			break
+		}
+
+		tokens.add(offset, 1)
+		offset += length
+	}
+
+	return tokens
+}
+
+func (m *tokenMap) add(start int, weight int) {
+	m.starts = append(m.starts, start)
+	m.weights = append(m.weights, m.weights[len(m.weights)-1]+weight)
+}
+
+// count returns the number of tokens starting in the byte range [begin, end) of the text.
+func (m *tokenMap) count(begin int, end int) int {
+	if end > m.textBytes {
+		end = m.textBytes
+	}
+
+	if begin >= end {
+		return 0
+	}
+
+	first := sort.SearchInts(m.starts, begin)
+	last := sort.SearchInts(m.starts, end)
+
+	weight := m.weights[last] - m.weights[first]
+	return (weight + m.divisor - 1) / m.divisor
+}
+
+// splitEnds splits byte range [begin, end) of the text at token boundaries into pieces
+// not longer than maxTokenLen tokens, a piece never ends inside of a UTF-8 character.
+func (m *tokenMap) splitEnds(text string, begin int, end int, maxTokenLen int) []int {
+	ends := make([]int, 0)
+
+	first := sort.SearchInts(m.starts, begin)
+	last := sort.SearchInts(m.starts, end)
+
+	pieceStart := begin
+	pieceFirst := first
+	for i := first; i < last; i++ {
+		cut := m.starts[i]
+		for cut < end && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+
+		// the first token of a piece is taken even if it's longer than maxTokenLen
+		if i == pieceFirst || cut <= pieceStart {
+			continue
+		}
+
+		weight := m.weights[i+1] - m.weights[pieceFirst]
+		if (weight+m.divisor-1)/m.divisor > maxTokenLen {
+			ends = append(ends, cut)
+			pieceStart = cut
+			pieceFirst = i
+		}
+	}
+
+	return append(ends, end)
+}
+
+// overlapStart returns byte offset of the text where the overlap number of tokens before the offset starts.
+func (m *tokenMap) overlapStart(text string, offset int, overlap int) int {
+	last := sort.SearchInts(m.starts, offset)
+
+	first := last
+	for first > 0 {
+		weight := m.weights[last] - m.weights[first-1]
+		if (weight+m.divisor-1)/m.divisor > overlap {
+			break
+		}
+		first--
+	}
+
+	if first == last {
+		return offset
+	}
+
+	start := m.starts[first]
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+
+	return start
+}
+
+func calcTokenNumExact(text string, encoding string) (int, error) {
+	if len(text) == 0 {
+		return 0, nil
+	}
+
+	tke, err := getTiktokenEncoding(encoding)
+	if err != nil {
+		return 0, err
+	}
+
+	tokens := tke.EncodeOrdinary(text)
+	return len(tokens), nil
+}
+
+func tokenizeExact(text string, encoding string) (*tokenMap, error) {
+	tke, err := getTiktokenEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := tke.EncodeOrdinary(text)
+
+	lengths := make([]int, len(tokens))
+	for i, token := range tokens {
+		lengths[i] = len(tke.Decode([]int{token}))
+	}
+
+	return newTokenMapFromLengths(text, lengths), nil
+}
+
+func getCohereEncoder() (*tokenizer.Encoder, error) {
+	cohereEncoder.once.Do(func() {
+		cohereEncoder.encoder, cohereEncoder.err = tokenizer.NewFromPrebuilt(CohereEncoding)
+	})
+
+	if cohereEncoder.err != nil {
+		return nil, fmt.Errorf("tokenizer.NewFromPrebuilt: %w", cohereEncoder.err)
+	}
+
+	return cohereEncoder.encoder, nil
+}
+
+func encodeCohere(text string) ([]string, error) {
+	encoder, err := getCohereEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	cohereEncoder.mutex.Lock()
+	defer cohereEncoder.mutex.Unlock()
+
+	_, tokenStrings := encoder.Encode(text)
+	return tokenStrings, nil
+}
+
+func calcTokenNumCohere(text string) (int, error) {
+	if len(text) == 0 {
+		return 0, nil
+	}
+
+	tokenStrings, err := encodeCohere(text)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(tokenStrings), nil
+}
+
+func tokenizeCohere(text string) (*tokenMap, error) {
+	tokenStrings, err := encodeCohere(text)
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make([]int, len(tokenStrings))
+	for i, tokenString := range tokenStrings {
+		lengths[i] = len(tokenString)
+	}
+
+	return newTokenMapFromLengths(text, lengths), nil
+}
+
+func calcTokenNumRoughly(text string) int {
+	weight := 0
+
+	prevIsLetter := false
+	for _, r := range text {
+		isLetter := unicode.IsLetter(r)
+
+		if !isLetter {
+			weight += roughNonLetterWeight
+		} else if !prevIsLetter {
+			weight += roughWordWeight
+		}
+
+		prevIsLetter = isLetter
+	}
+
+	return (weight + roughWeightDivisor - 1) / roughWeightDivisor
+}
+
+func tokenizeRoughly(text string) *tokenMap {
+	tokens := &tokenMap{
+		starts:    make([]int, 0),
+		weights:   make([]int, 1),
+		divisor:   roughWeightDivisor,
+		textBytes: len(text),
+	}
+
+	prevIsLetter := false
+	for i, r := range text {
+		isLetter := unicode.IsLetter(r)
+
+		if !isLetter {
+			tokens.add(i, roughNonLetterWeight)
+		} else if !prevIsLetter {
+			tokens.add(i, roughWordWeight)
+		}
+
+		prevIsLetter = isLetter
+	}
+
+	return tokens
+}
@@ -0,0 +1,375 @@
+package askai
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// maxTokenNum returns the largest number of tokens among the sentences.
+func maxTokenNum(t *testing.T, tok *Tokenizer, sentences ...string) int {
+	maxNum := 0
+	for _, sentence := range sentences {
+		tokenNum, err := tok.CalcTokenNum(sentence)
+		assert.NoError(t, err)
+
+		if tokenNum > maxNum {
+			maxNum = tokenNum
+		}
+	}
+
+	return maxNum
+}
+
+func TestSplitTextOne(t *testing.T) {
+	const text = "One sentence."
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 1)
+	assert.Equal(t, parts[0], text)
+}
+
+func TestSplitTextTwo(t *testing.T) {
+	const s1 = "Sentence one."
+	const s2 = "Sentence two."
+	const text = s1 + s2
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen/2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 2)
+	assert.Equal(t, parts[0], s1)
+	assert.Equal(t, parts[1], s2)
+}
+
+func TestSplitTextThree(t *testing.T) {
+	const s1 = "Sentence one."
+	const s2 = "Sentence two."
+	const s3 = "Sentence three."
+	const text = s1 + s2 + s3
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen/3)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 3)
+	assert.Equal(t, parts[0], s1)
+	assert.Equal(t, parts[1], s2)
+	assert.Equal(t, parts[2], s3)
+}
+
+func TestSplitTextMany(t *testing.T) {
+	const s1 = "How do I pass text with size larger than model input?"
+	const s2 = "Split it into multiple parts!"
+	const s3 = "Then pass each part to model for summarization."
+	const s4 = "Then concatenate all parts together."
+	const s5 = "Be like map-reduce..."
+
+	const text = s1 + s2 + s3 + s4 + s5
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen/5)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 5)
+	assert.Equal(t, parts[0], s1)
+	assert.Equal(t, parts[1], s2)
+	assert.Equal(t, parts[2], s3)
+	assert.Equal(t, parts[3], s4)
+	assert.Equal(t, parts[4], s5)
+}
+
+func TestSplitTextMessyPunctuation(t *testing.T) {
+	const text = "Some texts could be terrible with punctuation!!!Like this..........." +
+		"But what about that??????Oooo!!!???;;;!!....???So terrible.......!!!!!"
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen/4)
+	assert.NoError(t, err)
+
+	recovered := ""
+	for _, part := range parts {
+		recovered += part
+	}
+
+	assert.Equal(t, text, recovered)
+}
+
+func TestSplitTextOnlyPunctuation(t *testing.T) {
+	const text = "?????!!!!!"
+
+	tok := NewTokenizer("")
+
+	parts, err := tok.SplitText(text, 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), len(text))
+}
+
+func TestSplitTextEmpty(t *testing.T) {
+	tok := NewTokenizer("")
+
+	{
+		parts, err := tok.SplitText("", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, len(parts), 0)
+	}
+
+	{
+		parts, err := tok.SplitText("text", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, len(parts), 0)
+	}
+}
+
+func TestSplitTextWord(t *testing.T) {
+	tok := NewTokenizer("")
+
+	parts, err := tok.SplitText("word", 10)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 1)
+	assert.Equal(t, parts[0], "word")
+}
+
+func TestSplitTextEllipsis(t *testing.T) {
+	tok := NewTokenizer("")
+
+	parts, err := tok.SplitText("...", 10)
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(parts), 1)
+	assert.Equal(t, parts[0], "...")
+}
+
+func TestCalcTokenNumCohere(t *testing.T) {
+	const text = "Cohere models use byte-pair encoding, so the number of tokens is close to the number of words."
+
+	tok := NewTokenizer(CohereEncoding)
+
+	tokenNum, err := tok.CalcTokenNum(text)
+	assert.NoError(t, err)
+	assert.Greater(t, tokenNum, 0)
+	assert.Less(t, tokenNum, calcTokenNumRoughly(text))
+
+	tokenNum, err = tok.CalcTokenNum("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, tokenNum)
+}
+
+func TestSplitTextTrailingText(t *testing.T) {
+	const s1 = "First sentence."
+	const s2 = " Text without an end"
+	const text = s1 + s2
+
+	tok := NewTokenizer("")
+
+	tokenLen, err := tok.CalcTokenNum(s1)
+	assert.NoError(t, err)
+
+	parts, err := tok.SplitText(text, tokenLen)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{s1, s2}, parts)
+}
+
+func TestTokenizeRoughlyMatchesCalcTokenNum(t *testing.T) {
+	const text = "Some text, with punctuation... And unicode: привет мир!"
+
+	tokens := tokenizeRoughly(text)
+	assert.Equal(t, calcTokenNumRoughly(text), tokens.count(0, len(text)))
+}
+
+func TestTokenizeCohereMatchesCalcTokenNum(t *testing.T) {
+	const text = "Cohere tokens map back to the text. Each sentence gets its own tokens!"
+
+	tokens, err := tokenizeCohere(text)
+	assert.NoError(t, err)
+
+	tokenNum, err := calcTokenNumCohere(text)
+	assert.NoError(t, err)
+
+	assert.Equal(t, tokenNum, tokens.count(0, len(text)))
+}
+
+func makeBenchmarkText(size int) string {
+	const sentence = "The quick brown fox jumps over the lazy dog, version 3.14 of the story! Is it? "
+
+	return strings.Repeat(sentence, size/len(sentence)+1)[:size]
+}
+
+func benchmarkSplitText(b *testing.B, encoding string) {
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20} {
+		text := makeBenchmarkText(size)
+		tok := NewTokenizer(encoding)
+
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := tok.SplitText(text, 1000); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			// stays constant with linear scaling
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(text)), "ns/byte")
+		})
+	}
+}
+
+func BenchmarkSplitTextRough(b *testing.B) {
+	benchmarkSplitText(b, "")
+}
+
+func BenchmarkSplitTextCohere(b *testing.B) {
+	benchmarkSplitText(b, CohereEncoding)
+}
+
+func TestSplitTextHardSplitsLongSentence(t *testing.T) {
+	const text = "This sentence is much longer than a part and has no punctuation to split it at " +
+		"so it has to be cut at token boundaries, привет мир"
+
+	tok := NewTokenizer("")
+
+	const maxTokenLen = 10
+	parts, err := tok.SplitText(text, maxTokenLen)
+	assert.NoError(t, err)
+
+	assert.Greater(t, len(parts), 1)
+	assert.Equal(t, text, strings.Join(parts, ""))
+
+	for _, part := range parts {
+		assert.True(t, utf8.ValidString(part))
+
+		tokenNum, err := tok.CalcTokenNum(part)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, tokenNum, maxTokenLen)
+	}
+}
+
+func TestSplitTextOversizeSentence(t *testing.T) {
+	const s1 = "This sentence is a lot longer than the other one in the text."
+	const s2 = " Short one."
+	const text = s1 + s2
+
+	tok := NewTokenizer("")
+
+	tokenNum, err := tok.CalcTokenNum(s1)
+	assert.NoError(t, err)
+
+	// a sentence up to twice as long as a part makes a part of its own
+	maxTokenLen := (tokenNum + 1) / 2
+	parts, err := tok.SplitText(text, maxTokenLen)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{s1, s2}, parts)
+
+	// a longer one is split at token boundaries
+	maxTokenLen = tokenNum/2 - 1
+	parts, err = tok.SplitText(text, maxTokenLen)
+	assert.NoError(t, err)
+	assert.Greater(t, len(parts), 2)
+	assert.Equal(t, text, strings.Join(parts, ""))
+
+	for _, part := range parts {
+		partTokenNum, err := tok.CalcTokenNum(part)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, partTokenNum, maxTokenLen)
+	}
+}
+
+func TestSplitTextWithOverlap(t *testing.T) {
+	const s1 = "First sentence is here."
+	const s2 = " Second sentence is here."
+	const s3 = " Third sentence is here."
+	const text = s1 + s2 + s3
+
+	tok := NewTokenizer("")
+
+	const overlap = 3
+	maxTokenLen := maxTokenNum(t, tok, s1, s2, s3) + overlap
+
+	parts, err := tok.SplitTextWithOverlap(text, maxTokenLen, overlap)
+	assert.NoError(t, err)
+
+	// the word before the dot, the dot and the space make 3 tokens
+	assert.Equal(t, []string{s1, "here." + s2, "here." + s3}, parts)
+
+	for _, part := range parts {
+		tokenNum, err := tok.CalcTokenNum(part)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, tokenNum, maxTokenLen)
+	}
+}
+
+func TestSplitTextWithOverlapLimit(t *testing.T) {
+	tok := NewTokenizer("")
+
+	// overlap is limited to a half of a part, so splitting always makes progress
+	parts, err := tok.SplitTextWithOverlap("?????!!!!!", 2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"?", "??", "??", "??", "??", "?!", "!!", "!!", "!!", "!!"}, parts)
+
+	_, err = tok.SplitTextWithOverlap("text", -1, 0)
+	assert.Error(t, err)
+}
+
+func TestTokenizerConfig(t *testing.T) {
+	const text = "First sentence is here. Second sentence is here. Third sentence is here."
+
+	tok := NewTokenizerWithConfig("", TokenizerConfig{Overlap: 3}, nil)
+	parts, err := tok.SplitText(text, 10)
+	assert.NoError(t, err)
+
+	overlapped, err := NewTokenizer("").SplitTextWithOverlap(text, 10, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, overlapped, parts)
+
+	// tokenizers of the same encoding don't share their settings
+	parts, err = NewTokenizer("").SplitText(text, 10)
+	assert.NoError(t, err)
+	assert.NotEqual(t, overlapped, parts)
+
+	const unknownEncoding = "unknown_encoding"
+	_, err = NewTokenizerWithConfig(unknownEncoding, TokenizerConfig{Fallback: TokenizerFallbackError}, nil).CalcTokenNum(text)
+	assert.Error(t, err)
+
+	// the warning about rough estimation goes to the logger of the tokenizer, once per encoding
+	tiktokenEncodings.mutex.Lock()
+	delete(tiktokenEncodings.warned, unknownEncoding)
+	tiktokenEncodings.mutex.Unlock()
+
+	logger, hook := logtest.NewNullLogger()
+	tokenNum, err := NewTokenizerWithConfig(unknownEncoding, TokenizerConfig{}, logger).CalcTokenNum(text)
+	assert.NoError(t, err)
+	assert.Equal(t, calcTokenNumRoughly(text), tokenNum)
+	assert.Len(t, hook.Entries, 1)
+	assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+}
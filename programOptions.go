@@ -2,8 +2,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"strings"
 
+	"github.com/ilia-funtov/askai/pkg/askai"
 	"golang.org/x/exp/maps"
 )
 
@@ -16,25 +18,55 @@ type ProgramOptions struct {
 	printAIEngine bool
 	printPrompt   bool
 	noStdin       bool
+	firstAnswer   bool
+	firstMatch    string
+	judge         string
+	vote          bool
+	printAll      bool
+	compare       string
+	diffEngines   string
+	contentType   string
+	noRedact      bool
+	restore       bool
+	debug         bool
 }
 
-func (po *ProgramOptions) add(engine string) {
-	flag.StringVar(&po.cmdPrompt, "p", "", "Prompt to AI")
-	flag.BoolVar(&po.batchMode, "b", false, "Batch mode, do not ask for prompt if stdin is empty")
-	flag.StringVar(&po.aiEngineList, "e", engine, "AI engine to use")
-	flag.BoolVar(&po.allEngines, "ea", false, "Use all supported AI engines")
-	flag.BoolVar(&po.printAIEngine, "pe", false, "Print engine name in output")
-	flag.BoolVar(&po.printPrompt, "pp", false, "Print prompt in output")
-	flag.BoolVar(&po.noStdin, "nostdin", false, "Skip reading prompt from stdin")
+func (po *ProgramOptions) add(flagSet *flag.FlagSet, engine string) {
+	flagSet.StringVar(&po.cmdPrompt, "p", "", "Prompt to AI")
+	flagSet.BoolVar(&po.batchMode, "b", false, "Batch mode, do not ask for prompt if stdin is empty")
+	flagSet.StringVar(&po.aiEngineList, "e", engine, "AI engine to use, comma separated for several engines, '>' separated for fallback chain")
+	flagSet.BoolVar(&po.allEngines, "ea", false, "Use all supported AI engines")
+	flagSet.BoolVar(&po.printAIEngine, "pe", false, "Print engine name in output")
+	flagSet.BoolVar(&po.printPrompt, "pp", false, "Print prompt in output")
+	flagSet.BoolVar(&po.noStdin, "nostdin", false, "Skip reading prompt from stdin")
+	flagSet.BoolVar(&po.firstAnswer, "first", false, "Return the first good answer of several engines and cancel the others")
+	flagSet.StringVar(&po.firstMatch, "firstmatch", "", "Regular expression the first answer must match, implies -first")
+	flagSet.StringVar(&po.judge, "judge", "", "AI engine to merge answers of several engines into one")
+	flagSet.BoolVar(&po.vote, "vote", false, "Choose the most common answer of several engines")
+	flagSet.BoolVar(&po.printAll, "pa", false, "Print answers of all engines along with the one of -judge or -vote")
+	flagSet.StringVar(&po.compare, "compare", "", "Compare answers of engines side by side: columns, markdown or html")
+	flagSet.StringVar(&po.contentType, "ct", "", "Content type of long input to split it for summarization: auto, prose, markdown, code or log")
+	flagSet.BoolVar(&po.noRedact, "noredact", false, "Send the prompt as is, without redaction of secrets and personal data")
+	flagSet.BoolVar(&po.restore, "restore", false, "Put redacted values back into answers")
+	flagSet.BoolVar(&po.debug, "debug", false, "Log at debug level with full prompts and responses")
+	flagSet.StringVar(&po.diffEngines, "diff", "", "Two comma separated engines to show word-level diff of their answers with -compare")
 }
 
-func (po *ProgramOptions) parse() {
-	flag.Parse()
+func (po *ProgramOptions) parse(flagSet *flag.FlagSet, args []string) (bool, error) {
+	parsed, err := parseCommandFlags(flagSet, args)
+	if !parsed {
+		return false, err
+	}
 
 	po.aiEngineList = strings.ToLower(po.aiEngineList)
 
 	if po.allEngines {
-		po.engines = maps.Keys(engineMap)
+		po.engines = make([]string, 0, len(engineMap))
+		for _, engine := range maps.Keys(engineMap) {
+			if !askai.IsTestEngine(engine) {
+				po.engines = append(po.engines, engine)
+			}
+		}
 	} else {
 		engines := strings.Split(po.aiEngineList, ",")
 		engineMap := make(map[string]bool)
@@ -51,10 +83,72 @@ func (po *ProgramOptions) parse() {
 		}
 	}
 
-	if po.cmdPrompt == "" && flag.NArg() >= 1 {
+	if po.cmdPrompt == "" && flagSet.NArg() >= 1 {
 		// try to take first argument of command as prompt
-		po.cmdPrompt = flag.Arg(0)
+		po.cmdPrompt = flagSet.Arg(0)
 	}
 
 	po.cmdPrompt = strings.TrimSpace(po.cmdPrompt)
+
+	if po.firstMatch != "" {
+		po.firstAnswer = true
+	}
+
+	po.judge = strings.ToLower(strings.TrimSpace(po.judge))
+	po.compare = strings.ToLower(strings.TrimSpace(po.compare))
+	po.contentType = strings.ToLower(strings.TrimSpace(po.contentType))
+
+	return true, nil
+}
+
+func (po *ProgramOptions) validate() error {
+	if po.judge != "" && po.vote {
+		return fmt.Errorf("options -judge and -vote can't be used together")
+	}
+
+	if po.firstAnswer && (po.judge != "" || po.vote) {
+		return fmt.Errorf("option -first can't be used with -judge or -vote")
+	}
+
+	if po.contentType != "" && !askai.IsValidContentType(po.contentType) {
+		return fmt.Errorf("unknown content type: %s", po.contentType)
+	}
+
+	if po.compare != "" {
+		if !isValidCompareFormat(po.compare) {
+			return fmt.Errorf("unknown compare format: %s", po.compare)
+		}
+
+		if po.firstAnswer || po.judge != "" || po.vote {
+			return fmt.Errorf("option -compare can't be used with -first, -judge or -vote")
+		}
+	} else if po.diffEngines != "" {
+		return fmt.Errorf("option -diff requires -compare")
+	}
+
+	if po.noRedact && po.restore {
+		return fmt.Errorf("option -restore can't be used with -noredact")
+	}
+
+	return nil
+}
+
+// String formats options for the log, the prompt is hashed or truncated like other logged texts.
+func (po ProgramOptions) String() string {
+	type loggedOptions ProgramOptions
+
+	options := loggedOptions(po)
+	options.cmdPrompt = askai.LogText(logPromptMode, options.cmdPrompt)
+
+	return fmt.Sprintf("%+v", options)
+}
+
+// usedEngines returns all engines which can be asked with the given options.
+func (po *ProgramOptions) usedEngines() []string {
+	engines := askai.ExpandEngineChains(po.engines)
+	if po.judge != "" {
+		engines = append(engines, askai.SplitEngineChain(po.judge)...)
+	}
+
+	return engines
 }
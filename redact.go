@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+)
+
+const redactedPlaceholderPrefix = "[REDACTED_"
+
+// RedactionConfig configures removal of secrets and personal data from prompts before they are sent.
+// Rules map names to regular expressions, a rule with the name of a built-in one replaces it,
+// an empty expression turns it off. If an expression has groups, only the first matched group is redacted.
+type RedactionConfig struct {
+	Secrets bool              `json:"secrets"`
+	PII     bool              `json:"pii"`
+	Restore bool              `json:"restore"`
+	Rules   map[string]string `json:"rules"`
+}
+
+type redactionRule struct {
+	name    string
+	pattern string
+	pii     bool
+}
+
+// builtinRedactionRules are applied in order, so specific rules go before generic ones.
+var builtinRedactionRules = []redactionRule{
+	{name: "private_key", pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{name: "aws_access_key", pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{name: "aws_secret_key", pattern: `(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`},
+	{name: "openai_key", pattern: `\bsk-[A-Za-z0-9_-]{20,}`},
+	{name: "github_token", pattern: `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+	{name: "slack_token", pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+	{name: "jwt", pattern: `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	{name: "url_password", pattern: `\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:([^\s@/]+)@`},
+	{name: "secret_assignment",
+		pattern: `(?i)\b[a-z0-9_.-]*(?:password|passwd|pwd|secret|token|api_?key|access_?key)["']?\s*[=:]\s*` +
+			`(?:"([^"\n]{6,})"|'([^'\n]{6,})'|([^\s"',;]{6,}))`},
+	{name: "email", pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`, pii: true},
+	{name: "ipv4", pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`, pii: true},
+	{name: "ipv6", pattern: `\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`, pii: true},
+	{name: "phone", pattern: `(?:\+\d{1,3}[\s.-]?)?\(?\b\d{3}\)?[\s.-]?\d{3}[\s.-]?\d{4}\b`, pii: true},
+}
+
+type compiledRedactionRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Redactor replaces secrets in text with placeholders like [REDACTED_EMAIL_1] and can put them back.
+// The same value always gets the same placeholder, so answers referring to it stay consistent.
+// A nil Redactor leaves text as is.
+type Redactor struct {
+	rules        []compiledRedactionRule
+	restore      bool
+	placeholders map[string]string
+	values       map[string]string
+	ruleCounts   map[string]int
+}
+
+// getRedactionRules returns rules enabled by the config, built-in ones first.
+func getRedactionRules(config RedactionConfig) []redactionRule {
+	rules := make([]redactionRule, 0, len(builtinRedactionRules)+len(config.Rules))
+	builtin := make(map[string]bool, len(builtinRedactionRules))
+
+	for _, rule := range builtinRedactionRules {
+		builtin[rule.name] = true
+
+		if pattern, exists := config.Rules[rule.name]; exists {
+			rule.pattern = pattern
+		} else if (rule.pii && !config.PII) || (!rule.pii && !config.Secrets) {
+			continue
+		}
+
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	names := make([]string, 0, len(config.Rules))
+	for name := range config.Rules {
+		if !builtin[name] && config.Rules[name] != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rules = append(rules, redactionRule{name: name, pattern: config.Rules[name]})
+	}
+
+	return rules
+}
+
+func validateRedactionConfig(config RedactionConfig) error {
+	for name, pattern := range config.Rules {
+		if name == "" {
+			return fmt.Errorf("invalid value of config key redaction.rules: rule name is empty")
+		}
+
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid value of config key redaction.rules.%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func newRedactor(config RedactionConfig, restore bool) (*Redactor, error) {
+	if err := validateRedactionConfig(config); err != nil {
+		return nil, err
+	}
+
+	rules := getRedactionRules(config)
+
+	redactor := &Redactor{
+		rules:        make([]compiledRedactionRule, 0, len(rules)),
+		restore:      restore || config.Restore,
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		ruleCounts:   make(map[string]int),
+	}
+
+	for _, rule := range rules {
+		redactor.rules = append(redactor.rules, compiledRedactionRule{name: rule.name, re: regexp.MustCompile(rule.pattern)})
+	}
+
+	return redactor, nil
+}
+
+func (r *Redactor) redact(text string) string {
+	if r == nil {
+		return text
+	}
+
+	for _, rule := range r.rules {
+		text = r.redactRule(rule, text)
+	}
+
+	return text
+}
+
+func (r *Redactor) redactRule(rule compiledRedactionRule, text string) string {
+	matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var builder strings.Builder
+	last := 0
+
+	for _, match := range matches {
+		begin, end := match[0], match[1]
+		for group := 2; group+1 < len(match); group += 2 {
+			if match[group] >= 0 {
+				begin, end = match[group], match[group+1]
+				break
+			}
+		}
+
+		value := text[begin:end]
+		// a value which is already redacted by a previous rule is left alone
+		if value == "" || strings.Contains(value, redactedPlaceholderPrefix) {
+			continue
+		}
+
+		builder.WriteString(text[last:begin])
+		builder.WriteString(r.placeholder(rule.name, value))
+		last = end
+	}
+
+	builder.WriteString(text[last:])
+	return builder.String()
+}
+
+func (r *Redactor) placeholder(ruleName string, value string) string {
+	if placeholder, exists := r.placeholders[value]; exists {
+		return placeholder
+	}
+
+	r.ruleCounts[ruleName]++
+	placeholder := fmt.Sprintf("%s%s_%d]", redactedPlaceholderPrefix, strings.ToUpper(ruleName), r.ruleCounts[ruleName])
+
+	r.placeholders[value] = placeholder
+	r.values[placeholder] = value
+
+	return placeholder
+}
+
+func (r *Redactor) redactMessage(message askai.UserMessage) askai.UserMessage {
+	return askai.UserMessage{Prompt: r.redact(message.Prompt), Context: r.redact(message.Context)}
+}
+
+// restoreResponses puts redacted values back into the responses if restoring is enabled.
+func (r *Redactor) restoreResponses(responses []string) []string {
+	if r == nil || !r.restore || len(r.values) == 0 {
+		return responses
+	}
+
+	pairs := make([]string, 0, 2*len(r.values))
+	for placeholder, value := range r.values {
+		pairs = append(pairs, placeholder, value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	restored := make([]string, 0, len(responses))
+	for _, response := range responses {
+		restored = append(restored, replacer.Replace(response))
+	}
+
+	return restored
+}
+
+func (r *Redactor) restoreResponseMap(responseMap map[string][]string) map[string][]string {
+	restored := make(map[string][]string, len(responseMap))
+	for engineKey, responses := range responseMap {
+		restored[engineKey] = r.restoreResponses(responses)
+	}
+
+	return restored
+}
+
+// summary describes what was redacted like "2 aws_access_key, 1 email", it's empty if nothing was.
+func (r *Redactor) summary() string {
+	if r == nil || len(r.ruleCounts) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(r.ruleCounts))
+	for name := range r.ruleCounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%d %s", r.ruleCounts[name], name))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/exp/maps"
+)
+
+// Sources of secrets referenced from config like "env:OPENAI_API_KEY".
+const (
+	secretSourceEnv     = "env"
+	secretSourceCmd     = "cmd"
+	secretSourceKeyring = "keyring"
+	secretSourceAge     = "age"
+)
+
+// Key stores where API keys entered by user are saved.
+const (
+	keyStoreAuto    = "auto"
+	keyStoreKeyring = "keyring"
+	keyStoreAge     = "age"
+	keyStoreConfig  = "config"
+	keyStoreNone    = "none"
+)
+
+const secretSourceSeparator = ":"
+
+const keyringService = programName
+
+const secretCommandTimeout = 30 * time.Second
+
+const envAgePassphrase = envConfigPrefix + "AGE_PASSPHRASE"
+
+var agePassphrase struct {
+	once       sync.Once
+	passphrase string
+	err        error
+}
+
+func isValidKeyStore(keyStore string) bool {
+	switch keyStore {
+	case keyStoreAuto, keyStoreKeyring, keyStoreAge, keyStoreConfig, keyStoreNone:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseSecretReference splits reference to a secret like "cmd:pass show openai" into its source and argument.
+// Values without a known source are secrets themselves.
+func parseSecretReference(value string) (string, string, bool) {
+	source, argument, found := strings.Cut(value, secretSourceSeparator)
+	if !found {
+		return "", "", false
+	}
+
+	switch source {
+	case secretSourceEnv, secretSourceCmd, secretSourceKeyring, secretSourceAge:
+		return source, strings.TrimSpace(argument), true
+	default:
+		return "", "", false
+	}
+}
+
+func isSecretReference(value string) bool {
+	_, _, isReference := parseSecretReference(value)
+	return isReference
+}
+
+// resolveSecret returns the secret the value refers to, values which are not references are returned as is.
+// Keyring entries are named by the argument of the reference or by the default account.
+func resolveSecret(value string, account string) (string, error) {
+	source, argument, isReference := parseSecretReference(value)
+	if !isReference {
+		return value, nil
+	}
+
+	var secret string
+	var err error
+
+	switch source {
+	case secretSourceEnv:
+		secret = os.Getenv(argument)
+		if secret == "" {
+			err = fmt.Errorf("environment variable %s is not set", argument)
+		}
+	case secretSourceCmd:
+		secret, err = runSecretCommand(argument)
+	case secretSourceKeyring:
+		if argument == "" {
+			argument = account
+		}
+		secret, err = keyring.Get(keyringService, argument)
+	case secretSourceAge:
+		secret, err = decryptAgeFile(expandHomeDir(argument))
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret from %s: %w", source, err)
+	}
+
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret from %s is empty", source)
+	}
+
+	return secret, nil
+}
+
+// resolveAPIKeys resolves references to API keys of the engines' providers,
+// references of other providers are left out, so they are never used as keys.
+func resolveAPIKeys(apiKeys map[string]string, engines []string) (map[string]string, error) {
+	used := make(map[string]bool)
+	for _, engine := range engines {
+		aiProvider, _, err := askai.SplitEngineName(engine)
+		if err != nil {
+			return nil, err
+		}
+		used[aiProvider] = true
+	}
+
+	resolved := make(map[string]string, len(apiKeys))
+	for aiProvider, value := range apiKeys {
+		if !isSecretReference(value) {
+			resolved[aiProvider] = value
+			continue
+		}
+
+		if !used[aiProvider] {
+			continue
+		}
+
+		apiKey, err := resolveSecret(value, aiProvider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key for %s: %w", aiProvider, err)
+		}
+
+		resolved[aiProvider] = apiKey
+	}
+
+	return resolved, nil
+}
+
+// resolveAvailableAPIKeys resolves API keys of all providers for long-running modes, which can't ask user for keys.
+// Providers whose keys can't be resolved are left out with a warning.
+func resolveAvailableAPIKeys(config *ProgramConfig) map[string]string {
+	apiKeys := make(map[string]string)
+
+	for _, aiProvider := range maps.Keys(engineMap) {
+		resolved, err := resolveAPIKeys(config.APIKeys, []string{aiProvider})
+		if err != nil {
+			log.Warningf("%v", err)
+			continue
+		}
+
+		if apiKey, exists := resolved[aiProvider]; exists {
+			apiKeys[aiProvider] = apiKey
+			addLogSecret(apiKey)
+		}
+	}
+
+	return apiKeys
+}
+
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	// the command may ask for a password or PIN like "pass show" does, it gets the terminal
+	// and not stdin of the program, which may be the prompt piped to it
+	if tty, err := openTerminal(); err == nil {
+		defer tty.Close()
+		cmd.Stdin = tty
+	}
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command %q failed: %w", command, err)
+	}
+
+	return string(output), nil
+}
+
+func expandHomeDir(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
+// getAgePassphrase takes passphrase of encrypted key files from ASKAI_AGE_PASSPHRASE or asks for it once per run.
+func getAgePassphrase(confirm bool) (string, error) {
+	agePassphrase.once.Do(func() {
+		if passphrase := os.Getenv(envAgePassphrase); passphrase != "" {
+			agePassphrase.passphrase = passphrase
+			return
+		}
+
+		agePassphrase.passphrase, agePassphrase.err = readHiddenInput("Passphrase of API keys: ")
+		if agePassphrase.err == nil && confirm {
+			var repeated string
+			repeated, agePassphrase.err = readHiddenInput("Repeat passphrase: ")
+			if agePassphrase.err == nil && repeated != agePassphrase.passphrase {
+				agePassphrase.err = fmt.Errorf("passphrases don't match")
+			}
+		}
+
+		if agePassphrase.err == nil && agePassphrase.passphrase == "" {
+			agePassphrase.err = fmt.Errorf("passphrase is empty")
+		}
+	})
+
+	return agePassphrase.passphrase, agePassphrase.err
+}
+
+func decryptAgeFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	passphrase, err := getAgePassphrase(false)
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	secret, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	return string(secret), nil
+}
+
+func encryptAgeFile(path string, secret string) error {
+	passphrase, err := getAgePassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	writer, err := age.Encrypt(&data, recipient)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(writer, secret); err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	const dirPermissionMask = 0700
+	if err = os.MkdirAll(filepath.Dir(path), dirPermissionMask); err != nil {
+		return err
+	}
+
+	const keyPermissionMask = 0600
+	return os.WriteFile(path, data.Bytes(), keyPermissionMask)
+}
+
+// getAgeKeyFilePath returns path of encrypted file of API key of the provider.
+func getAgeKeyFilePath(aiProvider string) (string, error) {
+	userProgramDir, err := getProgramUserDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userProgramDir, defaultConfigDir, defaultKeysDir, aiProvider+".age"), nil
+}
+
+// storeAPIKey saves API key to the key store and returns the value to put into config:
+// a reference to the key, the key itself for "config" store or nothing for "none".
+// "auto" store is the keyring if it's available and encrypted file otherwise.
+func storeAPIKey(keyStore string, aiProvider string, apiKey string) (string, error) {
+	switch keyStore {
+	case keyStoreAuto, keyStoreKeyring:
+		err := keyring.Set(keyringService, aiProvider, apiKey)
+		if err == nil {
+			return secretSourceKeyring + secretSourceSeparator + aiProvider, nil
+		}
+
+		if keyStore == keyStoreKeyring {
+			return "", fmt.Errorf("failed to save API key to keyring: %w", err)
+		}
+
+		log.Infof("keyring is not available, API key is saved to encrypted file: %v", err)
+		fallthrough
+	case keyStoreAge:
+		path, err := getAgeKeyFilePath(aiProvider)
+		if err != nil {
+			return "", err
+		}
+
+		if err = encryptAgeFile(path, apiKey); err != nil {
+			return "", fmt.Errorf("failed to save API key to encrypted file: %w", err)
+		}
+
+		return secretSourceAge + secretSourceSeparator + path, nil
+	case keyStoreConfig:
+		return apiKey, nil
+	case keyStoreNone:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown key store: %s", keyStore)
+	}
+}
+
+// deleteStoredAPIKey deletes the API key the config value refers to from the key store.
+// Encrypted files are deleted only if they were saved by the program, secrets of other sources are left alone.
+func deleteStoredAPIKey(aiProvider string, value string) error {
+	source, argument, isReference := parseSecretReference(value)
+	if !isReference {
+		return nil
+	}
+
+	switch source {
+	case secretSourceKeyring:
+		if argument == "" {
+			argument = aiProvider
+		}
+
+		err := keyring.Delete(keyringService, argument)
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("failed to delete API key from keyring: %w", err)
+		}
+	case secretSourceAge:
+		path, err := getAgeKeyFilePath(aiProvider)
+		if err != nil {
+			return err
+		}
+
+		if filepath.Clean(expandHomeDir(argument)) != path {
+			return nil
+		}
+
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete encrypted API key: %w", err)
+		}
+	}
+
+	return nil
+}
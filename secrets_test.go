@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecretReference(t *testing.T) {
+	source, argument, isReference := parseSecretReference("env:OPENAI_API_KEY")
+	assert.True(t, isReference)
+	assert.Equal(t, secretSourceEnv, source)
+	assert.Equal(t, "OPENAI_API_KEY", argument)
+
+	source, argument, isReference = parseSecretReference("cmd:pass show openai")
+	assert.True(t, isReference)
+	assert.Equal(t, secretSourceCmd, source)
+	assert.Equal(t, "pass show openai", argument)
+
+	_, argument, isReference = parseSecretReference("keyring:")
+	assert.True(t, isReference)
+	assert.Equal(t, "", argument)
+
+	_, _, isReference = parseSecretReference("sk-abcdef")
+	assert.False(t, isReference)
+
+	_, _, isReference = parseSecretReference("key:with:colons")
+	assert.False(t, isReference)
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("ASKAI_TEST_SECRET", "env-key")
+
+	secret, err := resolveSecret("env:ASKAI_TEST_SECRET", "openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-key", secret)
+
+	secret, err = resolveSecret("cmd:echo cmd-key", "openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "cmd-key", secret)
+
+	secret, err = resolveSecret("plain-key", "openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain-key", secret)
+
+	_, err = resolveSecret("env:ASKAI_TEST_SECRET_NOT_SET", "openai")
+	assert.Error(t, err)
+
+	_, err = resolveSecret("cmd:true", "openai")
+	assert.Error(t, err)
+
+	_, err = resolveSecret("cmd:exit 1", "openai")
+	assert.Error(t, err)
+}
+
+func TestSecretCommandKeepsStdin(t *testing.T) {
+	if runtime.GOOS == "windows" || hasTerminal() {
+		t.Skip("the command reads the terminal if there is one")
+	}
+
+	reader, writer, err := os.Pipe()
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	_, err = writer.WriteString("piped prompt")
+	assert.NoError(t, err)
+	writer.Close()
+
+	savedStdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = savedStdin }()
+
+	secret, err := resolveSecret("cmd:cat; echo cmd-key", "openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "cmd-key", secret)
+
+	prompt, err := io.ReadAll(os.Stdin)
+	assert.NoError(t, err)
+	assert.Equal(t, "piped prompt", string(prompt))
+}
+
+func TestResolveAPIKeys(t *testing.T) {
+	t.Setenv("ASKAI_TEST_SECRET", "env-key")
+
+	apiKeys := map[string]string{
+		"openai": "env:ASKAI_TEST_SECRET",
+		"cohere": "cmd:exit 1",
+		"echo":   "plain-key",
+	}
+
+	resolved, err := resolveAPIKeys(apiKeys, []string{"openai:gpt-4"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"openai": "env-key", "echo": "plain-key"}, resolved)
+
+	_, err = resolveAPIKeys(apiKeys, []string{"openai", "cohere"})
+	assert.Error(t, err)
+}
+
+func TestAgeFileRoundTrip(t *testing.T) {
+	t.Setenv(envAgePassphrase, "test passphrase")
+	agePassphrase.once = sync.Once{}
+	defer func() { agePassphrase.once = sync.Once{} }()
+
+	path := filepath.Join(t.TempDir(), "keys", "openai.age")
+	assert.NoError(t, encryptAgeFile(path, "age-key"))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "age-key")
+
+	secret, err := resolveSecret("age:"+path, "openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "age-key", secret)
+}
+
+func TestStoreAPIKey(t *testing.T) {
+	value, err := storeAPIKey(keyStoreConfig, "openai", "plain-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain-key", value)
+
+	value, err = storeAPIKey(keyStoreNone, "openai", "plain-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	_, err = storeAPIKey("vault", "openai", "plain-key")
+	assert.Error(t, err)
+}
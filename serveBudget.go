@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+)
+
+// tokenBudget limits the number of tokens the server spends with API keys of providers a day.
+// Tokens are counted with tokenizers of engines after requests are answered, so requests
+// answered at the same time can exceed the budget a little; spent tokens aren't kept across restarts.
+type tokenBudget struct {
+	mutex  sync.Mutex
+	limits map[string]int // tokens a day by provider, providers without a limit are not limited
+	day    string
+	spent  map[string]int
+	now    func() time.Time
+}
+
+// newTokenBudget returns nil if no provider is limited, nil budget allows everything.
+func newTokenBudget(limits map[string]int) *tokenBudget {
+	budget := &tokenBudget{limits: make(map[string]int), spent: make(map[string]int), now: time.Now}
+	for aiProvider, limit := range limits {
+		if limit > 0 {
+			budget.limits[strings.ToLower(aiProvider)] = limit
+		}
+	}
+
+	if len(budget.limits) == 0 {
+		return nil
+	}
+
+	return budget
+}
+
+// resetDay starts spending anew when a new day comes, the mutex must be locked.
+func (b *tokenBudget) resetDay() {
+	if day := b.now().Format(time.DateOnly); day != b.day {
+		b.day = day
+		b.spent = make(map[string]int)
+	}
+}
+
+// allowedChain drops engines of the chain whose providers have spent their budget,
+// it fails if no engine is left.
+func (b *tokenBudget) allowedChain(chain string) (string, error) {
+	if b == nil {
+		return chain, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.resetDay()
+
+	engines := askai.SplitEngineChain(chain)
+	allowed := make([]string, 0, len(engines))
+	exhausted := make([]string, 0)
+	for _, engine := range engines {
+		aiProvider, _, err := askai.SplitEngineName(engine)
+		if err != nil {
+			return "", err
+		}
+
+		if limit, limited := b.limits[aiProvider]; limited && b.spent[aiProvider] >= limit {
+			exhausted = append(exhausted, aiProvider)
+			continue
+		}
+
+		allowed = append(allowed, engine)
+	}
+
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("token budget of %s is spent for today", strings.Join(exhausted, ", "))
+	}
+
+	return strings.Join(allowed, askai.EngineChainSeparator), nil
+}
+
+// spend adds tokens of the answered request to the provider of the engine which answered.
+func (b *tokenBudget) spend(engineKey string, usage *completionUsage) {
+	if b == nil || usage == nil {
+		return
+	}
+
+	aiProvider, _, err := askai.SplitEngineName(engineKey)
+	if err != nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.resetDay()
+
+	if _, limited := b.limits[aiProvider]; limited {
+		b.spent[aiProvider] += usage.TotalTokens
+	}
+}
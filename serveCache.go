@@ -0,0 +1,102 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+)
+
+// answerCache keeps answers of the server to repeated requests, so they are not asked from engines again.
+// It holds at most size answers dropping the least recently used ones, answers older than ttl are asked anew.
+type answerCache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // of *cachedAnswer, the most recently used first
+	now     func() time.Time
+}
+
+type cachedAnswer struct {
+	key     string
+	model   string
+	answers []string
+	usage   *completionUsage
+	created time.Time
+}
+
+// newAnswerCache returns nil if caching is off, methods of nil cache find nothing and keep nothing.
+func newAnswerCache(config ServeConfig) *answerCache {
+	if config.CacheSize <= 0 {
+		return nil
+	}
+
+	ttl := time.Duration(config.CacheTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultServeCacheTTL * time.Second
+	}
+
+	return &answerCache{
+		size:    config.CacheSize,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// answerCacheKey is a hash of the engine and the message before redaction, so secrets of one request
+// are never restored into answers to another one which differs only in its secrets.
+func answerCacheKey(engine string, message askai.UserMessage) string {
+	return hashText(strings.Join([]string{engine, message.Prompt, message.Context}, "\x00"))
+}
+
+func (c *answerCache) get(key string) (cachedAnswer, bool) {
+	if c == nil {
+		return cachedAnswer{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return cachedAnswer{}, false
+	}
+
+	answer := element.Value.(*cachedAnswer)
+	if c.now().Sub(answer.created) >= c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return cachedAnswer{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return *answer, true
+}
+
+func (c *answerCache) add(answer cachedAnswer) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	answer.created = c.now()
+	if element, exists := c.entries[answer.key]; exists {
+		element.Value = &answer
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[answer.key] = c.order.PushFront(&answer)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedAnswer).key)
+	}
+}
@@ -0,0 +1,713 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+const serveCommandName = "serve"
+
+const (
+	serveMaxRequestSize     = 32 << 20
+	serveReadHeaderTimeout  = 10 * time.Second
+	serveShutdownTimeout    = 30 * time.Second
+	serveDefaultModelName   = "default"
+	serveTokenLen           = 32
+	serveFinishReasonStop   = "stop"
+	serveErrorInvalid       = "invalid_request_error"
+	serveErrorAuth          = "authentication_error"
+	serveErrorPermission    = "permission_error"
+	serveErrorEngine        = "api_error"
+	serveErrorModelNotFound = "model_not_found"
+	serveErrorQuota         = "insufficient_quota"
+	serveCacheHeader        = "X-Askai-Cache"
+)
+
+// ServeConfig configures the local HTTP server with OpenAI-compatible API.
+type ServeConfig struct {
+	Addr      string         `json:"addr"`
+	Token     string         `json:"token"`
+	CacheSize int            `json:"cachesize"`
+	CacheTTL  int            `json:"cachettl"`
+	Budget    map[string]int `json:"budget"`
+}
+
+// ServeOptions are options of "askai serve" command.
+type ServeOptions struct {
+	addr string
+}
+
+func (so *ServeOptions) add(flagSet *flag.FlagSet, addr string) {
+	flagSet.StringVar(&so.addr, "addr", addr, "Address to listen on, like 127.0.0.1:8080")
+}
+
+func (so *ServeOptions) parse(args []string, addr string) (bool, error) {
+	flagSet := newCommandFlagSet(serveCommandName)
+	so.add(flagSet, addr)
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	if flagSet.NArg() > 0 {
+		return false, fmt.Errorf("serve expects no arguments, got %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	return true, validateServeAddr(so.addr)
+}
+
+func validateServeAddr(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid address to listen on: %q, expected host:port", addr)
+	}
+
+	return nil
+}
+
+func validateServeConfig(config ServeConfig) error {
+	if config.Addr == "" {
+		return nil
+	}
+
+	if err := validateServeAddr(config.Addr); err != nil {
+		return fmt.Errorf("invalid value of config key serve.addr: %w", err)
+	}
+
+	if config.CacheSize < 0 {
+		return fmt.Errorf("invalid value of config key serve.cachesize: %d, it can't be negative", config.CacheSize)
+	}
+
+	if config.CacheTTL < 0 {
+		return fmt.Errorf("invalid value of config key serve.cachettl: %d, it can't be negative", config.CacheTTL)
+	}
+
+	for aiProvider, limit := range config.Budget {
+		if limit < 0 {
+			return fmt.Errorf("invalid value of config key serve.budget.%s: %d, it can't be negative", aiProvider, limit)
+		}
+	}
+
+	return nil
+}
+
+// Server answers OpenAI-style requests with the engines of the program configuration.
+type Server struct {
+	config  ProgramConfig
+	token   string
+	host    string // host of the address the server listens on
+	engines map[string]askai.AIEngine
+	cache   *answerCache
+	budget  *tokenBudget
+}
+
+// chatContent is content of a chat message, clients send it as a string or as a list of text parts.
+type chatContent string
+
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content chatContent `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type completionRequest struct {
+	Model  string          `json:"model"`
+	Prompt json.RawMessage `json:"prompt"`
+	Stream bool            `json:"stream"`
+}
+
+type completionChoice struct {
+	Index        int          `json:"index"`
+	Message      *chatMessage `json:"message,omitempty"`
+	Delta        *chatMessage `json:"delta,omitempty"`
+	Text         *string      `json:"text,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type completionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   *completionUsage   `json:"usage,omitempty"`
+}
+
+type modelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type modelList struct {
+	Object string      `json:"object"`
+	Data   []modelInfo `json:"data"`
+}
+
+type serveError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// servedRequest is a request of any endpoint converted to a message to AI engines.
+type servedRequest struct {
+	model   string
+	message askai.UserMessage
+	stream  bool
+}
+
+func (c *chatContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = chatContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("message content must be a string or a list of parts")
+	}
+
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("message content of type %q is not supported", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+
+	*c = chatContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// runServeCommand runs HTTP server with OpenAI-compatible API until it's interrupted.
+func runServeCommand(args []string, config *ProgramConfig) error {
+	var options ServeOptions
+	if parsed, err := options.parse(args, config.Serve.Addr); !parsed {
+		return err
+	}
+
+	server, err := newServer(*config, options.addr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := &http.Server{
+		Addr:              options.addr,
+		Handler:           server.handler(),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	listener, err := net.Listen("tcp", options.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", options.addr, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving OpenAI-compatible API on http://%s/v1\n", listener.Addr())
+	if config.Serve.Token == "" {
+		fmt.Fprintf(os.Stderr, "Bearer token of this run is %s, set a permanent one with '%s %s set serve.token <token>'\n",
+			server.token, programName, configCommandName)
+	}
+	log.Infof("Serving on %s", listener.Addr())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Infof("Shutting down the server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// newServer resolves the API keys and the access token of the server, keys are never asked interactively.
+// A provider whose key can't be resolved is skipped, so the other engines can still be served.
+// If no token is configured, a random one is generated, so the server is never open to anyone.
+func newServer(config ProgramConfig, addr string) (*Server, error) {
+	config.APIKeys = resolveAvailableAPIKeys(&config)
+	for aiProvider := range config.APIKeys {
+		log.Infof("API key of %s is set", aiProvider)
+	}
+
+	token, err := resolveSecret(config.Serve.Token, serveCommandName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server token: %w", err)
+	}
+
+	if token == "" {
+		if token, err = newServeToken(); err != nil {
+			return nil, fmt.Errorf("failed to generate server token: %w", err)
+		}
+	}
+	addLogSecret(token)
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address to listen on: %q, expected host:port", addr)
+	}
+
+	return &Server{
+		config:  config,
+		token:   token,
+		host:    host,
+		engines: commandEngines(config),
+		cache:   newAnswerCache(config.Serve),
+		budget:  newTokenBudget(config.Serve.Budget),
+	}, nil
+}
+
+func newServeToken() (string, error) {
+	token := make([]byte, serveTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("/v1/completions", s.handleCompletions)
+	mux.HandleFunc("/v1/models", s.handleModels)
+
+	return s.authorize(mux)
+}
+
+// authorize rejects requests which may come from a web page opened in a browser and checks
+// bearer token of requests if the server has one.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowsHost(r.Host) {
+			writeServeError(w, http.StatusForbidden, serveErrorPermission, "", fmt.Sprintf("host %q is not allowed", r.Host))
+			return
+		}
+
+		if r.Header.Get("Origin") != "" {
+			writeServeError(w, http.StatusForbidden, serveErrorPermission, "", "requests from browsers are not allowed")
+			return
+		}
+
+		if s.token != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeServeError(w, http.StatusUnauthorized, serveErrorAuth, "", "invalid or missing bearer token")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowsHost protects from DNS rebinding: a web page can resolve its own domain name to a loopback
+// address and send requests to the server, but the browser sends its domain name as the host then.
+func (s *Server) allowsHost(hostHeader string) bool {
+	host, _, err := net.SplitHostPort(hostHeader)
+	if err != nil {
+		host = hostHeader
+	}
+	host = strings.Trim(host, "[]")
+
+	if host == "" {
+		return false
+	}
+
+	if strings.EqualFold(host, "localhost") || strings.EqualFold(host, s.host) {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	// a server listening on all interfaces is reached by any address of the machine
+	return ip.IsLoopback() || s.host == "" || net.ParseIP(s.host).IsUnspecified()
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request chatCompletionRequest
+	if !readServeRequest(w, r, &request) {
+		return
+	}
+
+	message, err := chatMessagesToUserMessage(request.Messages)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, serveErrorInvalid, "", err.Error())
+		return
+	}
+
+	s.answer(w, r, servedRequest{model: request.Model, message: message, stream: request.Stream}, "chat.completion")
+}
+
+func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	var request completionRequest
+	if !readServeRequest(w, r, &request) {
+		return
+	}
+
+	prompt, err := parseCompletionPrompt(request.Prompt)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, serveErrorInvalid, "", err.Error())
+		return
+	}
+
+	s.answer(w, r, servedRequest{model: request.Model, message: askai.UserMessage{Prompt: prompt}, stream: request.Stream},
+		"text_completion")
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeServeError(w, http.StatusMethodNotAllowed, serveErrorInvalid, "", "method is not allowed")
+		return
+	}
+
+	providers := maps.Keys(s.engines)
+	sort.Strings(providers)
+
+	models := modelList{Object: "list", Data: make([]modelInfo, 0, len(providers)+1)}
+	models.Data = append(models.Data, modelInfo{ID: serveDefaultModelName, Object: "model", OwnedBy: programName})
+	for _, aiProvider := range providers {
+		id := fmt.Sprintf("%s:%s", aiProvider, s.config.ProviderModel[aiProvider])
+		models.Data = append(models.Data, modelInfo{ID: id, Object: "model", OwnedBy: aiProvider})
+	}
+
+	writeServeJSON(w, http.StatusOK, models)
+}
+
+// answer asks the engine of the request, unless the same request is answered from the cache,
+// and writes its answers as choices of the completion.
+func (s *Server) answer(w http.ResponseWriter, r *http.Request, request servedRequest, object string) {
+	engine, err := resolveServeEngine(request.model, s.config, s.engines)
+	if err != nil {
+		writeServeError(w, http.StatusNotFound, serveErrorInvalid, serveErrorModelNotFound, err.Error())
+		return
+	}
+
+	message := request.message
+	if message.GetFullPrompt() == "" {
+		writeServeError(w, http.StatusBadRequest, serveErrorInvalid, "", "prompt to AI is empty")
+		return
+	}
+
+	cacheKey := answerCacheKey(engine, message)
+	if cached, found := s.cache.get(cacheKey); found {
+		log.Debugf("Request to %s is answered from the cache", engine)
+		w.Header().Set(serveCacheHeader, "hit")
+		writeCompletion(w, request, object, cached)
+		return
+	}
+
+	if engine, err = s.budget.allowedChain(engine); err != nil {
+		writeServeError(w, http.StatusTooManyRequests, serveErrorQuota, serveErrorQuota, err.Error())
+		return
+	}
+
+	redactor, err := newRedactor(s.config.Redaction, false)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, serveErrorEngine, "", err.Error())
+		return
+	}
+
+	message = redactor.redactMessage(message)
+	if summary := redactor.summary(); summary != "" {
+		log.Infof("Redacted from the prompt: %s", summary)
+	}
+
+	// every request is an audit session of its own
+	config := s.config
+	config.auditSession = newAuditSession()
+
+	responseMap, err := newAIClientWithEngines(config, s.engines).Ask(r.Context(), []string{engine}, message)
+	if err != nil {
+		writeServeError(w, http.StatusBadGateway, serveErrorEngine, "", err.Error())
+		return
+	}
+
+	answer := cachedAnswer{key: cacheKey}
+	for engineKey, responses := range responseMap {
+		answer.model = engineKey
+		answer.answers = redactor.restoreResponses(responses)
+		answer.usage = countServeUsage(s.engines, engineKey, message, responses)
+	}
+
+	s.budget.spend(answer.model, answer.usage)
+	s.cache.add(answer)
+	writeCompletion(w, request, object, answer)
+}
+
+// writeCompletion writes the answers as a completion or as a stream of its chunks.
+func writeCompletion(w http.ResponseWriter, request servedRequest, object string, answer cachedAnswer) {
+	idPrefix := "chatcmpl-"
+	if object == "text_completion" {
+		idPrefix = "cmpl-"
+	}
+
+	response := completionResponse{
+		ID:      idPrefix + newSessionID(),
+		Object:  object,
+		Created: time.Now().Unix(),
+		Model:   answer.model,
+	}
+
+	if request.stream {
+		writeServeStream(w, response, answer.answers)
+		return
+	}
+
+	for i, text := range answer.answers {
+		response.Choices = append(response.Choices, newCompletionChoice(i, object, strings.TrimSpace(text), false))
+	}
+
+	response.Usage = answer.usage
+	writeServeJSON(w, http.StatusOK, response)
+}
+
+// resolveServeEngine maps the model of a request to an engine: engine names like "openai:gpt-4" and chains
+// like "openai>cohere" are used as is, a model configured for a provider is asked from that provider,
+// "default" or no model means the engine of the configuration.
+func resolveServeEngine(model string, config ProgramConfig, engines map[string]askai.AIEngine) (string, error) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if model == "" || model == serveDefaultModelName {
+		model = config.Engine
+	}
+
+	chain := askai.SplitEngineChain(model)
+	if len(chain) == 0 {
+		return "", fmt.Errorf("no AI engine found for model %q", model)
+	}
+
+	for i, engine := range chain {
+		aiProvider, _, err := askai.SplitEngineName(engine)
+		if err != nil {
+			return "", err
+		}
+
+		if _, exists := engines[aiProvider]; exists {
+			continue
+		}
+
+		provider, found := findModelProvider(engine, config)
+		if !found {
+			return "", fmt.Errorf("model %q is not found, use an engine like openai:gpt-3.5-turbo", engine)
+		}
+
+		chain[i] = fmt.Sprintf("%s:%s", provider, engine)
+	}
+
+	return strings.Join(chain, askai.EngineChainSeparator), nil
+}
+
+func findModelProvider(aiModel string, config ProgramConfig) (string, bool) {
+	for aiProvider, providerModel := range config.ProviderModel {
+		if strings.EqualFold(providerModel, aiModel) {
+			return aiProvider, true
+		}
+	}
+
+	return "", false
+}
+
+// chatMessagesToUserMessage makes the last user message the prompt, the other messages
+// go to the context, so long conversations are summarized but the question is kept.
+func chatMessagesToUserMessage(messages []chatMessage) (askai.UserMessage, error) {
+	last := -1
+	for i, message := range messages {
+		if message.Role == "user" {
+			last = i
+		}
+	}
+
+	if last < 0 {
+		return askai.UserMessage{}, fmt.Errorf("messages contain no user message")
+	}
+
+	history := make([]string, 0, len(messages)-1)
+	for i, message := range messages {
+		if i != last && message.Content != "" {
+			history = append(history, fmt.Sprintf("%s: %s", message.Role, message.Content))
+		}
+	}
+
+	return askai.UserMessage{Prompt: string(messages[last].Content), Context: strings.Join(history, "\n\n")}, nil
+}
+
+// parseCompletionPrompt takes the prompt of legacy completion request, a list of prompts is joined.
+func parseCompletionPrompt(data json.RawMessage) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("prompt is missing")
+	}
+
+	var prompt string
+	if err := json.Unmarshal(data, &prompt); err == nil {
+		return prompt, nil
+	}
+
+	var prompts []string
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return "", fmt.Errorf("prompt must be a string or a list of strings")
+	}
+
+	return strings.Join(prompts, "\n"), nil
+}
+
+func newCompletionChoice(index int, object string, answer string, delta bool) completionChoice {
+	finishReason := serveFinishReasonStop
+	choice := completionChoice{Index: index, FinishReason: &finishReason}
+
+	switch {
+	case object == "text_completion":
+		choice.Text = &answer
+	case delta:
+		choice.Delta = &chatMessage{Role: "assistant", Content: chatContent(answer)}
+	default:
+		choice.Message = &chatMessage{Role: "assistant", Content: chatContent(answer)}
+	}
+
+	return choice
+}
+
+// countServeUsage counts tokens of the message sent and the answers received
+// with the tokenizer of the engine which answered.
+func countServeUsage(engines map[string]askai.AIEngine, engineKey string, message askai.UserMessage,
+	answers []string) *completionUsage {
+	aiProvider, aiModel, err := askai.SplitEngineName(engineKey)
+	if err != nil {
+		return nil
+	}
+
+	engine, exists := engines[aiProvider]
+	if !exists {
+		return nil
+	}
+
+	var usage completionUsage
+	if usage.PromptTokens, err = engine.CalcTokenNum(aiModel, message.GetFullPrompt()); err != nil {
+		return nil
+	}
+
+	for _, answer := range answers {
+		tokens, err := engine.CalcTokenNum(aiModel, answer)
+		if err != nil {
+			return nil
+		}
+		usage.CompletionTokens += tokens
+	}
+
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return &usage
+}
+
+// writeServeStream sends the answers as server-sent events, engines answer at once, so there is a chunk per answer.
+func writeServeStream(w http.ResponseWriter, response completionResponse, answers []string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if response.Object == "chat.completion" {
+		response.Object = "chat.completion.chunk"
+	}
+
+	for i, answer := range answers {
+		response.Choices = []completionChoice{newCompletionChoice(i, response.Object, strings.TrimSpace(answer), true)}
+
+		data, err := json.Marshal(response)
+		if err != nil {
+			log.Errorf("failed to serialize response: %v", err)
+			return
+		}
+
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func readServeRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeServeError(w, http.StatusMethodNotAllowed, serveErrorInvalid, "", "method is not allowed")
+		return false
+	}
+
+	// browsers send forms and plain text to other sites without asking, but not JSON
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeServeError(w, http.StatusUnsupportedMediaType, serveErrorInvalid, "", "content type of request must be application/json")
+		return false
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxRequestSize))
+	if err := decoder.Decode(request); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeServeError(w, http.StatusRequestEntityTooLarge, serveErrorInvalid, "", "request is too large")
+		} else {
+			writeServeError(w, http.StatusBadRequest, serveErrorInvalid, "", fmt.Sprintf("invalid request: %v", err))
+		}
+		return false
+	}
+
+	return true
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Errorf("failed to write response: %v", err)
+	}
+}
+
+func writeServeError(w http.ResponseWriter, status int, errorType string, code string, message string) {
+	log.Warningf("Request failed with status %d: %s", status, message)
+	writeServeJSON(w, status, map[string]serveError{"error": {Message: message, Type: errorType, Code: code}})
+}
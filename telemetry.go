@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const telemetryShutdownTimeout = 5 * time.Second
+
+// TelemetryConfig configures export of OpenTelemetry traces and metrics over OTLP/HTTP.
+type TelemetryConfig struct {
+	Enabled  bool              `json:"enabled"`
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers"`
+}
+
+// EngineMetrics are instruments of engine calls, they are created when telemetry is enabled.
+type EngineMetrics struct {
+	duration metric.Float64Histogram
+	tokens   metric.Int64Counter
+	errors   metric.Int64Counter
+}
+
+// telemetryEnabled is set when traces and metrics are exported.
+var telemetryEnabled bool
+
+var engineMetrics *EngineMetrics
+
+func validateTelemetryConfig(config TelemetryConfig) error {
+	if config.Endpoint == "" {
+		return nil
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("invalid value of config key telemetry.endpoint: %q, expected URL like http://localhost:4318",
+			config.Endpoint)
+	}
+
+	return nil
+}
+
+// initTelemetry sets up export of traces and metrics if telemetry is enabled.
+// The returned function flushes and stops the export, it must be called before the program exits.
+func initTelemetry(config TelemetryConfig) (func(), error) {
+	if !config.Enabled {
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+
+	traceOptions := []otlptracehttp.Option{otlptracehttp.WithHeaders(config.Headers)}
+	metricOptions := []otlpmetrichttp.Option{otlpmetrichttp.WithHeaders(config.Headers)}
+
+	// without endpoint the exporters use OTEL_EXPORTER_OTLP_* environment variables or localhost:4318
+	if config.Endpoint != "" {
+		endpoint, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid telemetry endpoint: %w", err)
+		}
+
+		traceOptions = append(traceOptions, otlptracehttp.WithEndpoint(endpoint.Host))
+		metricOptions = append(metricOptions, otlpmetrichttp.WithEndpoint(endpoint.Host))
+
+		if endpoint.Scheme == "http" {
+			traceOptions = append(traceOptions, otlptracehttp.WithInsecure())
+			metricOptions = append(metricOptions, otlpmetrichttp.WithInsecure())
+		}
+
+		if endpoint.Path != "" && endpoint.Path != "/" {
+			traceOptions = append(traceOptions, otlptracehttp.WithURLPath(path.Join(endpoint.Path, "v1/traces")))
+			metricOptions = append(metricOptions, otlpmetrichttp.WithURLPath(path.Join(endpoint.Path, "v1/metrics")))
+		}
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, traceOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(programName))
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warningf("telemetry error: %v", err)
+	}))
+
+	engineMetrics, err = newEngineMetrics(meterProvider.Meter(askai.TelemetryName))
+	if err != nil {
+		return nil, err
+	}
+
+	telemetryEnabled = true
+
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer cancel()
+
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			log.Warningf("failed to export traces: %v", err)
+		}
+
+		if err := meterProvider.Shutdown(ctx); err != nil {
+			log.Warningf("failed to export metrics: %v", err)
+		}
+	}
+
+	return shutdown, nil
+}
+
+func newEngineMetrics(meter metric.Meter) (*EngineMetrics, error) {
+	duration, err := meter.Float64Histogram("askai.engine.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of requests to AI engines"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric: %w", err)
+	}
+
+	tokens, err := meter.Int64Counter("askai.engine.tokens",
+		metric.WithUnit("{token}"), metric.WithDescription("Tokens sent to and received from AI engines"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric: %w", err)
+	}
+
+	errors, err := meter.Int64Counter("askai.engine.errors",
+		metric.WithUnit("{error}"), metric.WithDescription("Failed requests to AI engines"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric: %w", err)
+	}
+
+	return &EngineMetrics{duration: duration, tokens: tokens, errors: errors}, nil
+}
+
+// recordEngineCallTelemetry adds results of the call to its span and to the metrics.
+func recordEngineCallTelemetry(ctx context.Context, call askai.EngineCall) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("askai.prompt_tokens", call.PromptTokens),
+		attribute.Int("askai.response_tokens", call.ResponseTokens),
+		attribute.Int("askai.responses", len(call.Responses)),
+	)
+
+	if call.Err != nil {
+		span.RecordError(call.Err)
+		span.SetStatus(codes.Error, call.Err.Error())
+	}
+
+	if engineMetrics == nil {
+		return
+	}
+
+	engine := attribute.String("askai.engine", call.EngineKey())
+	kind := attribute.String("askai.kind", call.Kind)
+
+	engineMetrics.duration.Record(ctx, call.Duration.Seconds(), metric.WithAttributes(engine, kind))
+	engineMetrics.tokens.Add(ctx, int64(call.PromptTokens),
+		metric.WithAttributes(engine, kind, attribute.String("askai.direction", "prompt")))
+	engineMetrics.tokens.Add(ctx, int64(call.ResponseTokens),
+		metric.WithAttributes(engine, kind, attribute.String("askai.direction", "response")))
+
+	if call.Err != nil {
+		engineMetrics.errors.Add(ctx, 1, metric.WithAttributes(engine, kind))
+	}
+}
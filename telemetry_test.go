@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetry(t *testing.T) {
+	savedEnabled := telemetryEnabled
+	savedMetrics := engineMetrics
+	savedMock := engineMap["mock"]
+	savedTracerProvider := otel.GetTracerProvider()
+	defer func() {
+		telemetryEnabled = savedEnabled
+		engineMetrics = savedMetrics
+		engineMap["mock"] = savedMock
+		otel.SetTracerProvider(savedTracerProvider)
+	}()
+
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	otel.SetTracerProvider(tracerProvider)
+
+	metricReader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader))
+
+	var err error
+	telemetryEnabled = true
+	engineMetrics, err = newEngineMetrics(meterProvider.Meter(askai.TelemetryName))
+	assert.NoError(t, err)
+
+	path := writeMockResponses(t, `[{"match": "^Summarize:", "response": "Short."}]`)
+	engineMap["mock"] = askai.NewMockEngine(askai.MockConfig{ResponsesFile: path, MaxTokens: 50})
+
+	// the context is longer than the token limit of the mock engine, so it's summarized first
+	config := ProgramConfig{ProviderModel: defaultProviderModel, SummarizePrompt: "Summarize:"}
+	message := askai.UserMessage{Prompt: "Hello", Context: strings.Repeat("This sentence is rather long and needs shortening. ", 20)}
+	_, err = newAIClient(config).Ask(context.Background(), []string{"mock"}, message)
+	assert.NoError(t, err)
+
+	spans := spanRecorder.Ended()
+	names := make(map[string]int)
+	var levels []int64
+	for _, span := range spans {
+		names[span.Name()]++
+		for _, attr := range span.Attributes() {
+			if attr.Key == "askai.shorten.level" {
+				levels = append(levels, attr.Value.AsInt64())
+			}
+		}
+	}
+
+	assert.Equal(t, 1, names["askAI"])
+	assert.Equal(t, 1, names["callAIEngine"])
+	assert.Equal(t, 1, names["shortenMessage"])
+	assert.GreaterOrEqual(t, names["shortenText"], 1)
+	assert.Greater(t, names["AIEngine.AskAI"], 1)
+	assert.Contains(t, levels, int64(0))
+
+	var metrics metricdata.ResourceMetrics
+	assert.NoError(t, metricReader.Collect(context.Background(), &metrics))
+	assert.Len(t, metrics.ScopeMetrics, 1)
+
+	values := make(map[string]metricdata.Aggregation)
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		values[m.Name] = m.Data
+	}
+
+	duration, ok := values["askai.engine.duration"].(metricdata.Histogram[float64])
+	assert.True(t, ok)
+	for _, point := range duration.DataPoints {
+		engine, _ := point.Attributes.Value("askai.engine")
+		assert.Equal(t, "mock:mock", engine.AsString())
+	}
+
+	tokens, ok := values["askai.engine.tokens"].(metricdata.Sum[int64])
+	assert.True(t, ok)
+	for _, point := range tokens.DataPoints {
+		direction, _ := point.Attributes.Value("askai.direction")
+		assert.Contains(t, []string{"prompt", "response"}, direction.AsString())
+		assert.Greater(t, point.Value, int64(0))
+	}
+
+	_, failed := values["askai.engine.errors"]
+	assert.False(t, failed)
+}
+
+func TestEngineCallTelemetryError(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+
+	ctx, span := tracerProvider.Tracer(askai.TelemetryName).Start(context.Background(), "AIEngine.AskAI")
+	recordEngineCallTelemetry(ctx, askai.EngineCall{Kind: askai.CallKindAsk, Provider: "mock", Model: "mock",
+		Err: assert.AnError})
+	span.End()
+
+	spans := spanRecorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("askai.prompt_tokens", 0))
+}
+
+func TestValidateTelemetryConfig(t *testing.T) {
+	assert.NoError(t, validateTelemetryConfig(TelemetryConfig{}))
+	assert.NoError(t, validateTelemetryConfig(TelemetryConfig{Endpoint: "https://otel.example.com/otlp"}))
+	assert.Error(t, validateTelemetryConfig(TelemetryConfig{Endpoint: "localhost:4318"}))
+	assert.Error(t, validateTelemetryConfig(TelemetryConfig{Endpoint: "ftp://localhost"}))
+
+	shutdown, err := initTelemetry(TelemetryConfig{})
+	assert.NoError(t, err)
+	shutdown()
+	assert.False(t, telemetryEnabled)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/mattn/go-isatty"
+)
+
+const tokensCommandName = "tokens"
+
+const stdinSourceName = "-"
+
+// TokensOptions are options of "askai tokens" command.
+type TokensOptions struct {
+	aiEngineList string
+	engines      []string
+	chunkSize    int
+	chunkDir     string
+	chunksFile   string
+	contentType  string
+	files        []string
+}
+
+// TextSource is a text read from a file or stdin.
+type TextSource struct {
+	name string
+	text string
+}
+
+// TokenStats holds the number of tokens of a text for an engine.
+type TokenStats struct {
+	source    string
+	engineKey string
+	tokens    int
+	limit     int
+	chunks    []string
+	// chunkTokens are numbers of tokens of chunks counted by the same engine as tokens
+	chunkTokens []int
+	err         error
+}
+
+// remaining returns the number of tokens left for a response, negative if the text doesn't fit.
+func (s TokenStats) remaining() int {
+	return s.limit - s.tokens
+}
+
+// TextChunk is a line of JSONL file with chunks of split text.
+type TextChunk struct {
+	Source string `json:"source"`
+	Engine string `json:"engine"`
+	Index  int    `json:"index"`
+	Tokens int    `json:"tokens"`
+	Text   string `json:"text"`
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (to *TokensOptions) add(flagSet *flag.FlagSet, engine string) {
+	flagSet.StringVar(&to.aiEngineList, "e", engine, "AI engines to count tokens for, comma separated, engine is provider or provider:model")
+	flagSet.IntVar(&to.chunkSize, "chunk", 0, "Maximum number of tokens in a chunk, the model limit by default")
+	flagSet.StringVar(&to.chunkDir, "chunkdir", "", "Directory to write chunks of split text to, a file per chunk")
+	flagSet.StringVar(&to.chunksFile, "jsonl", "", "JSONL file to write chunks of split text to, '-' for stdout")
+	flagSet.StringVar(&to.contentType, "ct", "", "Content type of the text to split it: auto, prose, markdown, code or log")
+}
+
+func (to *TokensOptions) parse(args []string, engine string) (bool, error) {
+	flagSet := newCommandFlagSet(tokensCommandName)
+	to.add(flagSet, engine)
+
+	if parsed, err := parseCommandFlags(flagSet, args); !parsed {
+		return false, err
+	}
+
+	to.engines = askai.ExpandEngineChains(strings.Split(strings.ToLower(to.aiEngineList), ","))
+	to.files = flagSet.Args()
+	to.contentType = strings.ToLower(strings.TrimSpace(to.contentType))
+
+	return true, to.validate()
+}
+
+func (to *TokensOptions) validate() error {
+	if len(to.engines) == 0 {
+		return fmt.Errorf("no AI engine found")
+	}
+
+	if to.chunkSize < 0 {
+		return fmt.Errorf("invalid chunk size: %d", to.chunkSize)
+	}
+
+	if to.contentType != "" && !askai.IsValidContentType(to.contentType) {
+		return fmt.Errorf("unknown content type: %s", to.contentType)
+	}
+
+	return nil
+}
+
+func (to *TokensOptions) splitRequested() bool {
+	return to.chunkDir != "" || to.chunksFile != ""
+}
+
+func runTokensCommand(args []string, config *ProgramConfig) error {
+	var options TokensOptions
+	if parsed, err := options.parse(args, config.Engine); !parsed || err != nil {
+		return err
+	}
+
+	if options.contentType != "" {
+		config.Tokenizer.ContentType = options.contentType
+	}
+
+	sources, err := readTextSources(options.files)
+	if err != nil {
+		return err
+	}
+
+	allStats := make([]TokenStats, 0, len(sources)*len(options.engines))
+	for _, source := range sources {
+		for _, engine := range options.engines {
+			allStats = append(allStats, countTokens(source, engine, options, *config))
+		}
+	}
+
+	// keep stdout clean for chunks written to it
+	statsOutput := os.Stdout
+	if options.chunksFile == stdinSourceName {
+		statsOutput = os.Stderr
+	}
+
+	if err = printTokenStats(statsOutput, allStats); err != nil {
+		return err
+	}
+
+	if options.chunkDir != "" {
+		if err = writeChunkFiles(options.chunkDir, allStats); err != nil {
+			return err
+		}
+	}
+
+	if options.chunksFile != "" {
+		if err = writeChunksJSONL(options.chunksFile, allStats); err != nil {
+			return err
+		}
+	}
+
+	for _, stats := range allStats {
+		if stats.err != nil {
+			return fmt.Errorf("failed to count tokens for some engines")
+		}
+	}
+
+	return nil
+}
+
+func readTextSources(files []string) ([]TextSource, error) {
+	if len(files) == 0 {
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			return nil, fmt.Errorf("no input: pass files or pipe text to stdin")
+		}
+
+		files = []string{stdinSourceName}
+	}
+
+	sources := make([]TextSource, 0, len(files))
+	for _, file := range files {
+		var data []byte
+		var err error
+
+		if file == stdinSourceName {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("input from %s is not valid utf-8", file)
+		}
+
+		sources = append(sources, TextSource{name: file, text: string(data)})
+	}
+
+	return sources, nil
+}
+
+// countTokens counts tokens of the source for the engine and splits it into chunks if requested.
+func countTokens(source TextSource, engineName string, options TokensOptions, config ProgramConfig) TokenStats {
+	stats := TokenStats{source: source.name, engineKey: engineName}
+
+	aiProvider, aiModel, err := askai.SplitEngineName(engineName)
+	if err != nil {
+		stats.err = err
+		return stats
+	}
+
+	if aiModel == "" {
+		var exists bool
+		aiModel, exists = config.ProviderModel[aiProvider]
+		if !exists {
+			stats.err = fmt.Errorf("no provider model found for %s", aiProvider)
+			return stats
+		}
+	}
+
+	stats.engineKey = fmt.Sprintf("%s:%s", aiProvider, aiModel)
+
+	engine, exists := commandEngines(config)[aiProvider]
+	if !exists {
+		stats.err = fmt.Errorf("no engine found for %s", aiProvider)
+		return stats
+	}
+
+	stats.limit = engine.GetMaxTokenLimit(aiModel)
+
+	stats.tokens, err = engine.CalcTokenNum(aiModel, source.text)
+	if err != nil {
+		stats.err = fmt.Errorf(errorMessageCalcTokenNum, err)
+		return stats
+	}
+
+	if options.splitRequested() {
+		chunkSize := options.chunkSize
+		if chunkSize == 0 {
+			chunkSize = stats.limit
+		}
+
+		stats.chunks, err = engine.SplitText(aiModel, source.text, chunkSize)
+		if err != nil {
+			stats.err = fmt.Errorf("AIEngine.SplitText failed: %w", err)
+			return stats
+		}
+
+		stats.chunkTokens = make([]int, len(stats.chunks))
+		for i, chunk := range stats.chunks {
+			stats.chunkTokens[i], _ = engine.CalcTokenNum(aiModel, chunk)
+		}
+	}
+
+	return stats
+}
+
+func printTokenStats(w io.Writer, allStats []TokenStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SOURCE\tENGINE\tTOKENS\tLIMIT\tREMAINING\tCHUNKS")
+	for _, stats := range allStats {
+		if stats.err != nil {
+			fmt.Fprintf(tw, "%s\t%s\terror: %v\t\t\t\n", stats.source, stats.engineKey, stats.err)
+			continue
+		}
+
+		chunks := "-"
+		if stats.chunks != nil {
+			chunks = fmt.Sprint(len(stats.chunks))
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", stats.source, stats.engineKey, stats.tokens, stats.limit, stats.remaining(), chunks)
+	}
+
+	return tw.Flush()
+}
+
+// chunkFileName makes name of a chunk file like "notes.txt.openai-gpt-3.5-turbo.0001.txt".
+func chunkFileName(source string, engineKey string, index int) string {
+	if source == stdinSourceName {
+		source = "stdin"
+	}
+
+	name := fmt.Sprintf("%s.%s.%04d.txt", filepath.Base(source), engineKey, index+1)
+	return unsafeFileNameChars.ReplaceAllString(name, "-")
+}
+
+func writeChunkFiles(dir string, allStats []TokenStats) error {
+	const dirPermissionMask = 0770
+	if err := os.MkdirAll(dir, dirPermissionMask); err != nil {
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	const chunkPermissionMask = 0640
+	for _, stats := range allStats {
+		for i, chunk := range stats.chunks {
+			chunkPath := filepath.Join(dir, chunkFileName(stats.source, stats.engineKey, i))
+			if err := os.WriteFile(chunkPath, []byte(chunk), chunkPermissionMask); err != nil {
+				return fmt.Errorf("failed to write chunk: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeChunksJSONL(file string, allStats []TokenStats) error {
+	if file == stdinSourceName {
+		return encodeChunksJSONL(os.Stdout, allStats)
+	}
+
+	const chunkPermissionMask = 0640
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, chunkPermissionMask)
+	if err != nil {
+		return fmt.Errorf("failed to create chunks file: %w", err)
+	}
+
+	err = encodeChunksJSONL(f, allStats)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write chunks file: %w", closeErr)
+	}
+
+	return err
+}
+
+func encodeChunksJSONL(w io.Writer, allStats []TokenStats) error {
+	encoder := json.NewEncoder(w)
+
+	for _, stats := range allStats {
+		for i, chunk := range stats.chunks {
+			textChunk := TextChunk{Source: stats.source, Engine: stats.engineKey, Index: i, Text: chunk}
+			if i < len(stats.chunkTokens) {
+				textChunk.Tokens = stats.chunkTokens[i]
+			}
+
+			if err := encoder.Encode(textChunk); err != nil {
+				return fmt.Errorf("failed to write chunks: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
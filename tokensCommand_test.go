@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ilia-funtov/askai/pkg/askai"
+	"github.com/stretchr/testify/assert"
+)
+
+func roughTokenNum(t *testing.T, text string) int {
+	tokenNum, err := askai.NewTokenizer("").CalcTokenNum(text)
+	assert.NoError(t, err)
+	return tokenNum
+}
+
+func TestCountTokens(t *testing.T) {
+	const s1 = "First sentence."
+	const s2 = " Second sentence."
+
+	config := ProgramConfig{ProviderModel: defaultProviderModel}
+	source := TextSource{name: "notes.txt", text: s1 + s2}
+
+	stats := countTokens(source, "echo", TokensOptions{}, config)
+	assert.NoError(t, stats.err)
+	assert.Equal(t, "echo:echo", stats.engineKey)
+	assert.Equal(t, roughTokenNum(t, source.text), stats.tokens)
+	assert.Equal(t, askai.MaxTokensEcho, stats.limit)
+	assert.Equal(t, askai.MaxTokensEcho-stats.tokens, stats.remaining())
+	assert.Nil(t, stats.chunks)
+
+	options := TokensOptions{chunkSize: roughTokenNum(t, s2), chunksFile: "-"}
+	stats = countTokens(source, "echo", options, config)
+	assert.NoError(t, stats.err)
+	assert.Equal(t, []string{s1, s2}, stats.chunks)
+
+	stats = countTokens(source, "unknown", TokensOptions{}, config)
+	assert.Error(t, stats.err)
+}
+
+func TestPrintTokenStats(t *testing.T) {
+	allStats := []TokenStats{{source: "-", engineKey: "echo:echo", tokens: 10, limit: 4096}}
+
+	var output bytes.Buffer
+	assert.NoError(t, printTokenStats(&output, allStats))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, []string{"-", "echo:echo", "10", "4096", "4086", "-"}, strings.Fields(lines[1]))
+}
+
+func TestEncodeChunksJSONL(t *testing.T) {
+	config := ProgramConfig{ProviderModel: defaultProviderModel}
+	options := TokensOptions{chunkSize: roughTokenNum(t, " Two."), chunksFile: "-"}
+	stats := countTokens(TextSource{name: "a.txt", text: "One. Two."}, "echo", options, config)
+	assert.NoError(t, stats.err)
+	assert.Equal(t, []string{"One.", " Two."}, stats.chunks)
+	allStats := []TokenStats{stats}
+
+	var output bytes.Buffer
+	assert.NoError(t, encodeChunksJSONL(&output, allStats))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var chunk TextChunk
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &chunk))
+	assert.Equal(t, TextChunk{Source: "a.txt", Engine: "echo:echo", Index: 1, Tokens: roughTokenNum(t, " Two."), Text: " Two."}, chunk)
+}
+
+func TestChunkFileName(t *testing.T) {
+	assert.Equal(t, "notes.txt.openai-gpt-3.5-turbo.0001.txt", chunkFileName("docs/notes.txt", "openai:gpt-3.5-turbo", 0))
+	assert.Equal(t, "stdin.echo-echo.0012.txt", chunkFileName("-", "echo:echo", 11))
+}
@@ -7,11 +7,13 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/mattn/go-isatty"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
 )
 
 func getProgramUserDir() (string, error) {
@@ -53,6 +55,45 @@ func readPromptFromStdin(progOptions *ProgramOptions) (string, error) {
 	return strings.TrimSpace(stdinPrompt), nil
 }
 
+// openTerminal opens the controlling terminal, so user input can be read even if stdin is piped.
+func openTerminal() (*os.File, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+
+	return os.OpenFile(name, os.O_RDWR, 0)
+}
+
+func hasTerminal() bool {
+	tty, err := openTerminal()
+	if err != nil {
+		return false
+	}
+
+	tty.Close()
+	return true
+}
+
+// readHiddenInput asks for a secret on the controlling terminal without echoing it.
+func readHiddenInput(prompt string) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to read input from: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	input, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read input from terminal: %w", err)
+	}
+
+	return strings.TrimSpace(string(input)), nil
+}
+
 func readStreamedPrompt(reader io.Reader) (string, error) {
 	scanner := bufio.NewScanner(reader)
 	if scanner == nil {
@@ -81,7 +122,7 @@ func readStreamedPrompt(reader io.Reader) (string, error) {
 	return stdinPrompt, nil
 }
 
-func initLoggingToFile(config ProgramConfig) *os.File {
+func initLoggingToFile(config ProgramConfig) io.Writer {
 	logFilePath := defaultLogFileName
 
 	dir, err := filepath.Abs(config.LogDir)
@@ -94,14 +135,21 @@ func initLoggingToFile(config ProgramConfig) *os.File {
 		level = log.InfoLevel
 	}
 
+	var formatter log.Formatter = &log.TextFormatter{}
 	if config.LogFormatter == "json" {
-		log.SetFormatter(&log.JSONFormatter{})
+		formatter = &log.JSONFormatter{}
+	}
+
+	log.SetFormatter(&maskingFormatter{formatter: formatter})
+
+	if config.LogPrompts != "" {
+		logPromptMode = config.LogPrompts
 	}
 
-	return initLoggingToFileConfigless(logFilePath, level)
+	return initLoggingToFileConfigless(logFilePath, level, config)
 }
 
-func initLoggingToFileConfigless(logFilePath string, level log.Level) *os.File {
+func initLoggingToFileConfigless(logFilePath string, level log.Level, config ProgramConfig) io.Writer {
 	dirPath := filepath.Dir(logFilePath)
 
 	if fileInfo, err := os.Stat(dirPath); os.IsNotExist(err) || !fileInfo.IsDir() {
@@ -118,39 +166,15 @@ func initLoggingToFileConfigless(logFilePath string, level log.Level) *os.File {
 	logFile, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, logfilePermissionMask)
 	if err != nil {
 		log.Warningf("failed to create log file: %v", err)
-	}
 
-	if logFile != nil {
-		log.SetOutput(logFile)
-		log.SetLevel(level)
+		return nil
 	}
+	logFile.Close()
 
-	return logFile
-}
-
-func splitEngineName(engineName string) (string, string, error) {
-	parts := strings.Split(engineName, ":")
-	if len(parts) == 0 {
-		return "", "", fmt.Errorf("failed to split engine name: %s", engineName)
-	}
-
-	aiProvider := strings.TrimSpace(parts[0])
-	aiModel := ""
-	if len(parts) > 1 {
-		aiModel = strings.TrimSpace(parts[1])
-	}
-
-	return aiProvider, aiModel, nil
-}
-
-func makeFullPrompt(prompt string, context string) string {
-	if prompt != "" && context != "" {
-		return prompt + "\n" + context
-	} else if prompt != "" {
-		return prompt
-	} else if context != "" {
-		return context
-	}
+	// the file is reopened by the writer, which rotates it when it grows too big or old
+	logWriter := newLogFileWriter(logFilePath, config)
+	log.SetOutput(logWriter)
+	log.SetLevel(level)
 
-	return ""
+	return logWriter
 }